@@ -0,0 +1,270 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// DefaultPath é o arquivo de configuração lido quando ORCHESTRIUM_CONFIG não
+// está definido. O arquivo é opcional; sem ele valem os padrões abaixo
+const DefaultPath = "config.yaml"
+
+type Config struct {
+	// Interpreters mapeia o nome de um runtime para o comando que executa os
+	// scripts e as extensões associadas a ele
+	Interpreters map[string]Interpreter `yaml:"interpreters"`
+	// DefaultRuntime é usado quando nem o step, nem o shebang, nem a extensão
+	// identificam o runtime
+	DefaultRuntime string `yaml:"default_runtime"`
+	// Shell executa os comandos inline dos steps com run; o comando é
+	// passado como último argumento
+	Shell []string `yaml:"shell"`
+	// MasterKeyFile aponta para o arquivo com a chave mestra dos secrets. A
+	// variável ORCHESTRIUM_MASTER_KEY tem precedência sobre ele
+	MasterKeyFile string `yaml:"master_key_file"`
+	// WorkspaceCleanup é a política de limpeza do workspace das execuções
+	// quando o workflow não define workspace_cleanup
+	WorkspaceCleanup string `yaml:"workspace_cleanup"`
+	// ArtifactsMaxMB limita o espaço ocupado pelos artifacts de cada
+	// workflow; os das execuções mais antigas são removidos primeiro
+	ArtifactsMaxMB int `yaml:"artifacts_max_mb"`
+	// LimitsBackend aplica os limites de recursos dos steps com "rlimit" ou
+	// "cgroup" (cgroup v2, para memória e processos, sob CgroupRoot)
+	LimitsBackend string `yaml:"limits_backend"`
+	CgroupRoot    string `yaml:"cgroup_root"`
+	// MaxRunningSteps limita quantos steps rodam ao mesmo tempo no servidor,
+	// somando todos os workflows; os demais aguardam na fila global. Zero
+	// desliga o limite
+	MaxRunningSteps int `yaml:"max_running_steps"`
+	// PriorityAging é quantos segundos de espera na fila somam um ponto à
+	// prioridade de um step. Zero desliga o envelhecimento
+	PriorityAging int `yaml:"priority_aging"`
+	// Pools são recursos compartilhados entre workflows, com o número de
+	// vagas de cada um. Steps com pool aguardam vaga antes de começar
+	Pools map[string]int `yaml:"pools"`
+	// AgentLease é quantos segundos um agente remoto pode ficar sem dar
+	// sinal antes de o step dele voltar para a fila
+	AgentLease int `yaml:"agent_lease"`
+	// AgentWait é quantos segundos um step com runs_on espera um agente
+	// antes de a tentativa falhar; a falha conta como timeout para o retry
+	AgentWait int `yaml:"agent_wait"`
+	// AgentTokenFile aponta para o arquivo com o token exigido dos agentes.
+	// A variável ORCHESTRIUM_AGENT_TOKEN tem precedência sobre ele
+	AgentTokenFile string `yaml:"agent_token_file"`
+
+	// MasterKey é a chave mestra carregada de ORCHESTRIUM_MASTER_KEY ou de
+	// MasterKeyFile. Vazia, o cofre de secrets fica indisponível
+	MasterKey string `yaml:"-"`
+	// AgentToken autentica os agentes remotos junto ao servidor, carregado de
+	// ORCHESTRIUM_AGENT_TOKEN ou de AgentTokenFile. Vazio, os agentes ficam
+	// desabilitados e steps com runs_on são recusados
+	AgentToken string `yaml:"-"`
+}
+
+type Interpreter struct {
+	Command    []string `yaml:"command"`
+	Extensions []string `yaml:"extensions"`
+}
+
+// Default retorna a configuração usada quando não há config.yaml
+func Default() *Config {
+	return &Config{
+		Interpreters: map[string]Interpreter{
+			"python": {Command: []string{"python3"}, Extensions: []string{".py"}},
+			"bash":   {Command: []string{"bash"}, Extensions: []string{".sh", ".bash"}},
+			"sh":     {Command: []string{"sh"}},
+			"node":   {Command: []string{"node"}, Extensions: []string{".js", ".mjs", ".cjs"}},
+		},
+		DefaultRuntime: "python",
+		Shell:          []string{"sh", "-c"},
+		// Execuções com falha mantêm os arquivos para investigação
+		WorkspaceCleanup: "on_success",
+		ArtifactsMaxMB:   1024,
+		LimitsBackend:    "rlimit",
+		CgroupRoot:       "/sys/fs/cgroup/orchestrium",
+		MaxRunningSteps:  16,
+		PriorityAging:    60,
+		AgentLease:       30,
+		AgentWait:        300,
+	}
+}
+
+// Load lê a configuração do servidor. Os valores do arquivo são aplicados
+// sobre os padrões, então basta declarar o que muda
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if err := cfg.loadMasterKey(); err != nil {
+			return nil, err
+		}
+		return cfg, cfg.loadAgentToken()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+
+	var file Config
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("erro ao fazer parse de %s: %w", path, err)
+	}
+
+	// Nos campos da fila, zero é um valor válido e diferente de omitido
+	var queue struct {
+		MaxRunningSteps *int `yaml:"max_running_steps"`
+		PriorityAging   *int `yaml:"priority_aging"`
+	}
+	if err := yaml.Unmarshal(data, &queue); err != nil {
+		return nil, fmt.Errorf("erro ao fazer parse de %s: %w", path, err)
+	}
+
+	for name, interpreter := range file.Interpreters {
+		if len(interpreter.Command) == 0 {
+			return nil, fmt.Errorf("interpreter %s sem command", name)
+		}
+		cfg.Interpreters[name] = interpreter
+	}
+
+	if len(file.Shell) > 0 {
+		cfg.Shell = file.Shell
+	}
+
+	if file.DefaultRuntime != "" {
+		cfg.DefaultRuntime = file.DefaultRuntime
+	}
+
+	if _, exists := cfg.Interpreters[cfg.DefaultRuntime]; !exists {
+		return nil, fmt.Errorf("default_runtime %s não está em interpreters", cfg.DefaultRuntime)
+	}
+
+	switch file.WorkspaceCleanup {
+	case "":
+	case "always", "on_success", "never":
+		cfg.WorkspaceCleanup = file.WorkspaceCleanup
+	default:
+		return nil, fmt.Errorf("workspace_cleanup deve ser always, on_success ou never")
+	}
+
+	if file.ArtifactsMaxMB < 0 {
+		return nil, fmt.Errorf("artifacts_max_mb não pode ser negativo")
+	}
+	if file.ArtifactsMaxMB > 0 {
+		cfg.ArtifactsMaxMB = file.ArtifactsMaxMB
+	}
+
+	switch file.LimitsBackend {
+	case "":
+	case "rlimit", "cgroup":
+		cfg.LimitsBackend = file.LimitsBackend
+	default:
+		return nil, fmt.Errorf("limits_backend deve ser rlimit ou cgroup")
+	}
+
+	if queue.MaxRunningSteps != nil {
+		if *queue.MaxRunningSteps < 0 {
+			return nil, fmt.Errorf("max_running_steps não pode ser negativo")
+		}
+		cfg.MaxRunningSteps = *queue.MaxRunningSteps
+	}
+
+	if queue.PriorityAging != nil {
+		if *queue.PriorityAging < 0 {
+			return nil, fmt.Errorf("priority_aging não pode ser negativo")
+		}
+		cfg.PriorityAging = *queue.PriorityAging
+	}
+
+	if file.CgroupRoot != "" {
+		cfg.CgroupRoot = file.CgroupRoot
+	}
+
+	for name, slots := range file.Pools {
+		if name == "" {
+			return nil, fmt.Errorf("pools: nome vazio")
+		}
+		if slots < 1 {
+			return nil, fmt.Errorf("pools.%s deve ter ao menos uma vaga", name)
+		}
+	}
+	cfg.Pools = file.Pools
+
+	if file.AgentLease < 0 {
+		return nil, fmt.Errorf("agent_lease não pode ser negativo")
+	}
+	if file.AgentLease > 0 {
+		cfg.AgentLease = file.AgentLease
+	}
+
+	if file.AgentWait < 0 {
+		return nil, fmt.Errorf("agent_wait não pode ser negativo")
+	}
+	if file.AgentWait > 0 {
+		cfg.AgentWait = file.AgentWait
+	}
+
+	cfg.MasterKeyFile = file.MasterKeyFile
+	if err := cfg.loadMasterKey(); err != nil {
+		return nil, err
+	}
+
+	cfg.AgentTokenFile = file.AgentTokenFile
+	if err := cfg.loadAgentToken(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadMasterKey lê a chave mestra do ambiente ou, se não houver, do arquivo
+// configurado em master_key_file
+func (cfg *Config) loadMasterKey() error {
+	if key := os.Getenv("ORCHESTRIUM_MASTER_KEY"); key != "" {
+		cfg.MasterKey = key
+		return nil
+	}
+
+	if cfg.MasterKeyFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(cfg.MasterKeyFile)
+	if err != nil {
+		return fmt.Errorf("erro ao ler master_key_file: %w", err)
+	}
+
+	cfg.MasterKey = strings.TrimSpace(string(data))
+	if cfg.MasterKey == "" {
+		return fmt.Errorf("master_key_file %s está vazio", cfg.MasterKeyFile)
+	}
+
+	return nil
+}
+
+// loadAgentToken lê o token dos agentes do ambiente ou, se não houver, do
+// arquivo configurado em agent_token_file
+func (cfg *Config) loadAgentToken() error {
+	if token := os.Getenv("ORCHESTRIUM_AGENT_TOKEN"); token != "" {
+		cfg.AgentToken = token
+		return nil
+	}
+
+	if cfg.AgentTokenFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(cfg.AgentTokenFile)
+	if err != nil {
+		return fmt.Errorf("erro ao ler agent_token_file: %w", err)
+	}
+
+	cfg.AgentToken = strings.TrimSpace(string(data))
+	if cfg.AgentToken == "" {
+		return fmt.Errorf("agent_token_file %s está vazio", cfg.AgentTokenFile)
+	}
+
+	return nil
+}
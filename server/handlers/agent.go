@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"orchestrium.sh/models"
+)
+
+// agentAuth exige o token dos agentes nas rotas usadas por eles. Sem token
+// configurado no servidor, os agentes ficam desabilitados
+func (h *WorkflowHandler) agentAuth(ctx *gin.Context) {
+	if !h.service.AgentsEnabled() {
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "agentes remotos desabilitados: token de agente não configurado"})
+		return
+	}
+
+	token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if !h.service.CheckAgentToken(token) {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token de agente inválido"})
+		return
+	}
+	ctx.Next()
+}
+
+func (h *WorkflowHandler) ListAgents(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, h.service.ListAgents())
+}
+
+func (h *WorkflowHandler) RegisterAgent(ctx *gin.Context) {
+	var request models.AgentRegistration
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, h.service.RegisterAgent(request))
+}
+
+func (h *WorkflowHandler) DeregisterAgent(ctx *gin.Context) {
+	if err := h.service.DeregisterAgent(ctx.Param("id")); err != nil {
+		ctx.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Agente removido com sucesso"})
+}
+
+// PollAgent responde com o próximo step para o agente ou 204 se nenhum
+// chegar dentro do intervalo de long polling
+func (h *WorkflowHandler) PollAgent(ctx *gin.Context) {
+	task, err := h.service.PollAgent(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if task == nil {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, task)
+}
+
+func (h *WorkflowHandler) AgentHeartbeat(ctx *gin.Context) {
+	var request models.AgentHeartbeat
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cancel, err := h.service.AgentHeartbeat(ctx.Param("id"), request.TaskId)
+	if err != nil {
+		ctx.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.AgentHeartbeatResponse{Cancel: cancel})
+}
+
+func (h *WorkflowHandler) AppendAgentLogs(ctx *gin.Context) {
+	var request models.AgentLogRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.AppendAgentLogs(ctx.Param("id"), ctx.Param("taskId"), request.Lines); err != nil {
+		ctx.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *WorkflowHandler) CompleteAgentTask(ctx *gin.Context) {
+	var request models.AgentResult
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.CompleteAgentTask(ctx.Param("id"), ctx.Param("taskId"), request); err != nil {
+		ctx.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Resultado registrado"})
+}
+
+// agentErrorStatus usa 404 para agente desconhecido, o que leva o agente a
+// se registrar de novo, e 409 para lease perdido, o que o faz abandonar o step
+func agentErrorStatus(err error) int {
+	switch err.Error() {
+	case "agente não encontrado":
+		return http.StatusNotFound
+	case "lease expirado":
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -17,11 +17,53 @@ func SetupRoutes(r *gin.Engine, workflowService *services.WorkflowService) {
 		workflows.GET("/:id", workflowHandler.GetWorkflow)
 		workflows.PATCH("/:id/pause", workflowHandler.PauseWorkflow)
 		workflows.PATCH("/:id/resume", workflowHandler.ResumeWorkflow)
+		workflows.POST("/:id/validate", workflowHandler.ValidateWorkflow)
+		workflows.GET("/:id/environment", workflowHandler.GetEnvironment)
+
+		// Run operations
+		workflows.POST("/:id/run", workflowHandler.RunWorkflow)
+		workflows.GET("/:id/runs", workflowHandler.ListRuns)
+		workflows.GET("/:id/runs/:runId", workflowHandler.GetRun)
+		workflows.POST("/:id/runs/:runId/cancel", workflowHandler.CancelRun)
+		workflows.GET("/:id/runs/:runId/logs", workflowHandler.GetRunLogs)
+		workflows.GET("/:id/runs/:runId/logs/:step", workflowHandler.GetStepLog)
+		workflows.GET("/:id/runs/:runId/environment", workflowHandler.GetEnvironmentLog)
+		workflows.GET("/:id/runs/:runId/artifacts", workflowHandler.ListArtifacts)
+		workflows.GET("/:id/runs/:runId/artifacts/:step/*path", workflowHandler.DownloadArtifact)
 
 		// File operations
 		workflows.GET("/:id/file/:name", workflowHandler.GetFile)
 		workflows.POST("/:id/file/:name", workflowHandler.CreateFile)
 		workflows.PATCH("/:id/file/:name", workflowHandler.UpdateFile)
 		workflows.DELETE("/:id/file/:name", workflowHandler.DeleteFile)
+
+		// Secret operations
+		workflows.GET("/:id/secrets", workflowHandler.ListSecrets)
+		workflows.PUT("/:id/secrets/:name", workflowHandler.SetSecret)
+		workflows.DELETE("/:id/secrets/:name", workflowHandler.DeleteSecret)
+	}
+
+	// Fila global de steps
+	r.GET("/queue", workflowHandler.GetQueue)
+	r.GET("/pools", workflowHandler.GetPools)
+
+	// Agentes remotos; as rotas usadas pelos próprios agentes exigem o token
+	r.GET("/agents", workflowHandler.ListAgents)
+	agents := r.Group("/agents", workflowHandler.agentAuth)
+	{
+		agents.POST("", workflowHandler.RegisterAgent)
+		agents.DELETE("/:id", workflowHandler.DeregisterAgent)
+		agents.GET("/:id/poll", workflowHandler.PollAgent)
+		agents.POST("/:id/heartbeat", workflowHandler.AgentHeartbeat)
+		agents.POST("/:id/tasks/:taskId/logs", workflowHandler.AppendAgentLogs)
+		agents.POST("/:id/tasks/:taskId/result", workflowHandler.CompleteAgentTask)
+	}
+
+	// Secrets globais, disponíveis para todos os workflows
+	secrets := r.Group("/secrets")
+	{
+		secrets.GET("", workflowHandler.ListSecrets)
+		secrets.PUT("/:name", workflowHandler.SetSecret)
+		secrets.DELETE("/:name", workflowHandler.DeleteSecret)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"orchestrium.sh/models"
+)
+
+// Os handlers de secrets atendem as rotas globais e as de workflow; nas
+// globais o parâmetro id fica vazio
+
+func (h *WorkflowHandler) ListSecrets(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	secrets, err := h.service.ListSecrets(id)
+	if err != nil {
+		ctx.JSON(secretErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"secrets": secrets})
+}
+
+func (h *WorkflowHandler) SetSecret(ctx *gin.Context) {
+	id := ctx.Param("id")
+	name := ctx.Param("name")
+
+	var request models.SecretRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.SetSecret(id, name, request.Value); err != nil {
+		ctx.JSON(secretErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Secret salvo com sucesso"})
+}
+
+func (h *WorkflowHandler) DeleteSecret(ctx *gin.Context) {
+	id := ctx.Param("id")
+	name := ctx.Param("name")
+
+	if err := h.service.DeleteSecret(id, name); err != nil {
+		ctx.JSON(secretErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Secret removido com sucesso"})
+}
+
+func secretErrorStatus(err error) int {
+	switch err.Error() {
+	case "workflow não encontrado", "secret não encontrado":
+		return http.StatusNotFound
+	case "chave mestra não configurada":
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -62,6 +65,11 @@ func (h *WorkflowHandler) CreateWorkflow(ctx *gin.Context) {
 
 	id, err := h.service.CreateWorkflow(request)
 	if err != nil {
+		var invalid *services.InvalidWorkflowError
+		if errors.As(err, &invalid) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "errors": invalid.Errors})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -71,8 +79,9 @@ func (h *WorkflowHandler) CreateWorkflow(ctx *gin.Context) {
 
 func (h *WorkflowHandler) PauseWorkflow(ctx *gin.Context) {
 	id := ctx.Param("id")
+	cancelActive := ctx.Query("cancel") == "true"
 
-	if err := h.service.PauseWorkflow(id); err != nil {
+	if err := h.service.PauseWorkflow(id, cancelActive); err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
@@ -84,6 +93,12 @@ func (h *WorkflowHandler) ResumeWorkflow(ctx *gin.Context) {
 	id := ctx.Param("id")
 
 	if err := h.service.ResumeWorkflow(id); err != nil {
+		var invalid *services.InvalidWorkflowError
+		if errors.As(err, &invalid) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "errors": invalid.Errors})
+			return
+		}
+
 		statusCode := http.StatusInternalServerError
 		if err.Error() == "o workflow já está ativo" {
 			statusCode = http.StatusBadRequest
@@ -95,6 +110,229 @@ func (h *WorkflowHandler) ResumeWorkflow(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"message": "Workflow retomado com sucesso"})
 }
 
+func (h *WorkflowHandler) ValidateWorkflow(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	// Sem corpo, valida o conf.yaml salvo; com corpo, valida a configuração enviada
+	var workflow *models.WorkflowResponse
+	if ctx.Request.ContentLength > 0 {
+		workflow = &models.WorkflowResponse{}
+		if err := ctx.ShouldBindJSON(workflow); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	errs, err := h.service.ValidateWorkflow(id, workflow)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.ValidationResponse{
+		Valid:  len(errs) == 0,
+		Errors: errs,
+	})
+}
+
+func (h *WorkflowHandler) GetEnvironment(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	env, err := h.service.GetEnvironment(id)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":          id,
+		"environment": env,
+	})
+}
+
+func (h *WorkflowHandler) RunWorkflow(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	var request *models.RunRequest
+	if ctx.Request.ContentLength > 0 {
+		request = &models.RunRequest{}
+		if err := ctx.ShouldBindJSON(request); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	runID, status, err := h.service.RunNow(id, request)
+	if err != nil {
+		var invalid *services.InvalidWorkflowError
+		if errors.As(err, &invalid) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "errors": invalid.Errors})
+			return
+		}
+		if err.Error() == "workflow não encontrado" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"id":     id,
+		"run_id": runID,
+		"status": status,
+	})
+}
+
+func (h *WorkflowHandler) ListRuns(ctx *gin.Context) {
+	id := ctx.Param("id")
+	status := ctx.Query("status")
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+
+	runs, err := h.service.ListRuns(id, status, page, limit)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, runs)
+}
+
+func (h *WorkflowHandler) GetRun(ctx *gin.Context) {
+	id := ctx.Param("id")
+	runID := ctx.Param("runId")
+
+	run, err := h.service.GetRun(id, runID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, run)
+}
+
+func (h *WorkflowHandler) CancelRun(ctx *gin.Context) {
+	id := ctx.Param("id")
+	runID := ctx.Param("runId")
+
+	if err := h.service.CancelRun(id, runID); err != nil {
+		if err.Error() == "execução não está em andamento" {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "Cancelamento solicitado"})
+}
+
+func (h *WorkflowHandler) GetRunLogs(ctx *gin.Context) {
+	id := ctx.Param("id")
+	runID := ctx.Param("runId")
+
+	steps, err := h.service.GetRunLogs(id, runID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":     id,
+		"run_id": runID,
+		"steps":  steps,
+	})
+}
+
+func (h *WorkflowHandler) GetStepLog(ctx *gin.Context) {
+	id := ctx.Param("id")
+	runID := ctx.Param("runId")
+	step := ctx.Param("step")
+	stream := ctx.Query("stream")
+
+	entries, err := h.service.GetStepLog(id, runID, step, stream)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"run_id":  runID,
+		"step":    step,
+		"entries": entries,
+	})
+}
+
+func (h *WorkflowHandler) GetEnvironmentLog(ctx *gin.Context) {
+	id := ctx.Param("id")
+	runID := ctx.Param("runId")
+
+	run, err := h.service.GetRun(id, runID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := h.service.GetEnvironmentLog(id, runID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":          id,
+		"run_id":      runID,
+		"environment": run.Environment,
+		"entries":     entries,
+	})
+}
+
+func (h *WorkflowHandler) ListArtifacts(ctx *gin.Context) {
+	id := ctx.Param("id")
+	runID := ctx.Param("runId")
+
+	artifacts, err := h.service.ListArtifacts(id, runID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":        id,
+		"run_id":    runID,
+		"artifacts": artifacts,
+	})
+}
+
+func (h *WorkflowHandler) DownloadArtifact(ctx *gin.Context) {
+	id := ctx.Param("id")
+	runID := ctx.Param("runId")
+	step := ctx.Param("step")
+	artifactPath := strings.TrimPrefix(ctx.Param("path"), "/")
+
+	path, err := h.service.GetArtifactPath(id, runID, step, artifactPath)
+	if err != nil {
+		if err.Error() == "artifact expirado" {
+			ctx.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.FileAttachment(path, filepath.Base(path))
+}
+
+func (h *WorkflowHandler) GetQueue(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, h.service.GetQueue())
+}
+
+func (h *WorkflowHandler) GetPools(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, h.service.GetPools())
+}
+
 func (h *WorkflowHandler) GetFile(ctx *gin.Context) {
 	id := ctx.Param("id")
 	filename := ctx.Param("name")
@@ -163,10 +401,7 @@ func (h *WorkflowHandler) CreateFile(ctx *gin.Context) {
 		content = "#!/usr/bin/env python3\n# Novo script\n\nprint(\"Hello, World!\")\n"
 	}
 
-	normalizedFilename := strings.TrimSuffix(filename, ".py")
-	normalizedFilename += ".py"
-
-	if err := h.service.CreateFile(id, normalizedFilename, content); err != nil {
+	if err := h.service.CreateFile(id, filename, content); err != nil {
 		if err.Error() == "workflow não encontrado" {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
@@ -182,7 +417,7 @@ func (h *WorkflowHandler) CreateFile(ctx *gin.Context) {
 	ctx.JSON(http.StatusCreated, gin.H{
 		"message":  "Arquivo criado com sucesso",
 		"id":       id,
-		"filename": normalizedFilename,
+		"filename": filename,
 	})
 }
 
@@ -208,4 +443,4 @@ func (h *WorkflowHandler) DeleteFile(ctx *gin.Context) {
 		"id":       id,
 		"filename": filename,
 	})
-}
\ No newline at end of file
+}
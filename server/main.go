@@ -3,20 +3,54 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
 
+	"orchestrium.sh/config"
 	"orchestrium.sh/handlers"
 	"orchestrium.sh/services"
 )
 
 func main() {
+	// Os steps isolados passam por uma reexecução do próprio servidor, que
+	// prepara os namespaces antes de iniciar o comando (ver services.RunSandbox)
+	if len(os.Args) > 1 && os.Args[1] == services.SandboxCommand {
+		services.RunSandbox(os.Args[2:])
+		return
+	}
+	// Steps com rlimits passam pelo mesmo tipo de reexecução, que define os
+	// limites antes de iniciar o comando (ver services.RunLimits)
+	if len(os.Args) > 1 && os.Args[1] == services.LimitsCommand {
+		services.RunLimits(os.Args[2:])
+		return
+	}
+
+	configPath := os.Getenv("ORCHESTRIUM_CONFIG")
+	if configPath == "" {
+		configPath = config.DefaultPath
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatal("Falha ao carregar configuração:", err)
+	}
+
+	// "orchestrium agent" executa steps de um servidor remoto em vez de
+	// servir a API (ver services.RunAgent)
+	if len(os.Args) > 1 && os.Args[1] == services.AgentCommand {
+		if err := services.RunAgent(cfg, os.Args[2:]); err != nil {
+			log.Fatal("Falha no agente:", err)
+		}
+		return
+	}
+
 	scheduler := cron.New(cron.WithSeconds())
 	scheduler.Start()
 	defer scheduler.Stop()
 
-	workflowService := services.NewWorkflowService(scheduler)
+	workflowService := services.NewWorkflowService(scheduler, cfg)
 
 	if err := workflowService.BootstrapWorkflows(); err != nil {
 		log.Printf("Erro ao fazer bootstrap dos workflows: %v\n", err)
@@ -30,4 +64,4 @@ func main() {
 	if err := r.Run(":8080"); err != nil {
 		log.Fatal("Falha ao iniciar servidor:", err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,99 @@
+package models
+
+import "time"
+
+// AgentRegistration é enviado pelo agente ao se registrar no servidor
+type AgentRegistration struct {
+	Name   string   `json:"name" binding:"required"`
+	Labels []string `json:"labels"`
+}
+
+// AgentSession é a resposta ao registro: o id do agente e os intervalos, em
+// segundos, que ele deve respeitar. Sem heartbeat dentro de LeaseTimeout, o
+// step em execução no agente volta para a fila
+type AgentSession struct {
+	Id                string `json:"id"`
+	LeaseTimeout      int    `json:"lease_timeout"`
+	HeartbeatInterval int    `json:"heartbeat_interval"`
+	PollWait          int    `json:"poll_wait"`
+}
+
+// Agent é um agente remoto registrado no servidor
+type Agent struct {
+	Id           string        `json:"id"`
+	Name         string        `json:"name"`
+	Labels       []string      `json:"labels"`
+	Status       string        `json:"status"` // "idle", "busy"
+	RegisteredAt time.Time     `json:"registered_at"`
+	LastSeen     time.Time     `json:"last_seen"`
+	Task         *AgentTaskRef `json:"task,omitempty"`
+}
+
+// AgentTaskRef identifica uma tentativa de step destinada aos agentes
+type AgentTaskRef struct {
+	Id           string     `json:"id"`
+	WorkflowId   string     `json:"workflow_id"`
+	RunId        string     `json:"run_id"`
+	Step         string     `json:"step"`
+	Attempt      int        `json:"attempt"`
+	RunsOn       []string   `json:"runs_on"`
+	EnqueuedAt   time.Time  `json:"enqueued_at"`
+	LeaseExpires *time.Time `json:"lease_expires,omitempty"`
+	Requeues     int        `json:"requeues,omitempty"`
+}
+
+// AgentList lista os agentes registrados e os steps aguardando um agente
+type AgentList struct {
+	Agents  []Agent        `json:"agents"`
+	Pending []AgentTaskRef `json:"pending"`
+}
+
+// AgentTask é uma tentativa de step entregue a um agente: a definição do
+// step, os arquivos do workspace, as variáveis da execução e os limites de
+// recursos já resolvidos
+type AgentTask struct {
+	Id         string      `json:"id"`
+	WorkflowId string      `json:"workflow_id"`
+	RunId      string      `json:"run_id"`
+	Attempt    int         `json:"attempt"`
+	Step       Step        `json:"step"`
+	Files      []AgentFile `json:"files"`
+	Env        []string    `json:"env"`
+	Limits     Limits      `json:"limits"`
+}
+
+// AgentFile é um arquivo do workspace enviado ao agente
+type AgentFile struct {
+	Path string `json:"path"`
+	Mode uint32 `json:"mode"`
+	Data []byte `json:"data"`
+}
+
+// AgentHeartbeat é enviado periodicamente pelo agente; TaskId vazio indica
+// que ele está livre
+type AgentHeartbeat struct {
+	TaskId string `json:"task_id"`
+}
+
+// AgentHeartbeatResponse avisa o agente se a execução do step foi cancelada
+type AgentHeartbeatResponse struct {
+	Cancel bool `json:"cancel"`
+}
+
+// AgentLogLine é uma linha de saída do step encaminhada pelo agente
+type AgentLogLine struct {
+	Stream string `json:"stream"` // "stdout", "stderr"
+	Line   string `json:"line"`
+}
+
+// AgentLogRequest agrupa as linhas enviadas de uma vez pelo agente
+type AgentLogRequest struct {
+	Lines []AgentLogLine `json:"lines"`
+}
+
+// AgentResult é o resultado da tentativa executada pelo agente, com os
+// outputs gravados no arquivo de outputs
+type AgentResult struct {
+	Attempt AttemptState      `json:"attempt"`
+	Outputs map[string]string `json:"outputs,omitempty"`
+}
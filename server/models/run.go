@@ -0,0 +1,138 @@
+package models
+
+import "time"
+
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// RunRequest são os campos opcionais de um disparo manual. Steps limita a
+// execução aos steps informados; Upstream inclui também as dependências deles.
+// Params traz os valores dos parâmetros declarados no conf.yaml e Priority,
+// se informado, substitui as prioridades do workflow e dos steps
+type RunRequest struct {
+	Steps    []string       `json:"steps"`
+	Upstream bool           `json:"upstream"`
+	Params   map[string]any `json:"params"`
+	Priority *int           `json:"priority"`
+}
+
+type Run struct {
+	Id          string            `json:"id"`
+	WorkflowId  string            `json:"workflow_id"`
+	Trigger     string            `json:"trigger"`
+	Params      map[string]string `json:"params,omitempty"`
+	Priority    int               `json:"priority"`
+	Workspace   string            `json:"workspace,omitempty"`
+	Environment *Environment      `json:"environment,omitempty"`
+	Status      string            `json:"status"` // "pending", "queued", "running", "success", "failed", "cancelled", "skipped"
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	StartTime   time.Time         `json:"start_time"`
+	EndTime     *time.Time        `json:"end_time,omitempty"`
+	Duration    time.Duration     `json:"duration"`
+	Steps       []ExecutionState  `json:"steps"`
+}
+
+type ExecutionState struct {
+	StepName      string            `json:"step_name"`
+	Status        string            `json:"status"` // "pending", "queued", "running", "success", "failed", "cancelled", "upstream_failed", "skipped"
+	Output        string            `json:"output"`
+	Stderr        string            `json:"stderr"`
+	Error         string            `json:"error"`
+	Signal        string            `json:"signal,omitempty"`
+	LimitExceeded string            `json:"limit_exceeded,omitempty"` // "memory", "cpu", "open_files", "processes"
+	Outputs       map[string]string `json:"outputs,omitempty"`
+	Artifacts     []Artifact        `json:"artifacts,omitempty"`
+	StartTime     time.Time         `json:"start_time"`
+	EndTime       time.Time         `json:"end_time"`
+	Duration      time.Duration     `json:"duration"`
+	Attempts      []AttemptState    `json:"attempts"`
+}
+
+// Environment descreve o virtualenv criado a partir do requirements.txt ou
+// pyproject.toml de src/. Hash identifica o conteúdo do arquivo de dependências
+type Environment struct {
+	Hash      string    `json:"hash"`
+	Source    string    `json:"source"`
+	Status    string    `json:"status"` // "missing", "building", "ready", "failed"
+	Cached    bool      `json:"cached,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	StartTime time.Time `json:"start_time,omitzero"`
+	EndTime   time.Time `json:"end_time,omitzero"`
+}
+
+// Artifact é um arquivo produzido por um step e guardado com a execução.
+// Expired indica que o arquivo foi removido pela retenção
+type Artifact struct {
+	Step    string `json:"step"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	Expired bool   `json:"expired,omitempty"`
+}
+
+// AttemptState registra uma tentativa individual de um step
+type AttemptState struct {
+	Number        int           `json:"number"`
+	Status        string        `json:"status"` // "success", "failed", "cancelled"
+	ExitCode      int           `json:"exit_code"`
+	TimedOut      bool          `json:"timed_out"`
+	Signal        string        `json:"signal,omitempty"`
+	LimitExceeded string        `json:"limit_exceeded,omitempty"`
+	Error         string        `json:"error"`
+	StartTime     time.Time     `json:"start_time"`
+	EndTime       time.Time     `json:"end_time"`
+	Duration      time.Duration `json:"duration"`
+}
+
+// QueueStats descreve a fila global de steps. MaxRunningSteps zero significa sem limite
+type QueueStats struct {
+	MaxRunningSteps int           `json:"max_running_steps"`
+	Running         int           `json:"running"`
+	Waiting         int           `json:"waiting"`
+	OldestWait      time.Duration `json:"oldest_wait"`
+	Served          int           `json:"served"`
+	AvgWait         time.Duration `json:"avg_wait"`
+	MaxWait         time.Duration `json:"max_wait"`
+	Items           []QueueItem   `json:"items"`
+}
+
+// QueueItem é um step aguardando vaga na fila global ou em um pool nomeado
+type QueueItem struct {
+	WorkflowId string        `json:"workflow_id"`
+	RunId      string        `json:"run_id"`
+	Step       string        `json:"step"`
+	Slots      int           `json:"slots"`
+	Priority   int           `json:"priority"`
+	Effective  int           `json:"effective_priority"`
+	EnqueuedAt time.Time     `json:"enqueued_at"`
+	Wait       time.Duration `json:"wait"`
+}
+
+// PoolStats descreve um pool nomeado da configuração: quantas vagas tem,
+// quantas estão ocupadas, por quem, e quem aguarda
+type PoolStats struct {
+	Name    string       `json:"name"`
+	Slots   int          `json:"slots"`
+	Used    int          `json:"used"`
+	Holders []PoolHolder `json:"holders"`
+	Waiting []QueueItem  `json:"waiting"`
+}
+
+// PoolHolder é um step ocupando vagas de um pool nomeado
+type PoolHolder struct {
+	WorkflowId string    `json:"workflow_id"`
+	RunId      string    `json:"run_id"`
+	Step       string    `json:"step"`
+	Slots      int       `json:"slots"`
+	Since      time.Time `json:"since"`
+}
+
+type RunListResponse struct {
+	Runs  []Run `json:"runs"`
+	Total int   `json:"total"`
+	Page  int   `json:"page"`
+	Limit int   `json:"limit"`
+}
@@ -8,21 +8,117 @@ type WorkflowRequest struct {
 }
 
 type WorkflowResponse struct {
-	Id    string      `json:"id" yaml:"-"`
-	Name  string      `json:"name" yaml:"name"`
-	Expr  string      `json:"expr" yaml:"expr"`
-	Stts  bool        `json:"stts" yaml:"stts"`
-	Steps []Step      `json:"steps" yaml:"steps"`
-	Next  *time.Time  `json:"next,omitempty" yaml:"-"`
-	Prev  *time.Time  `json:"prev,omitempty" yaml:"-"`
+	Id          string `json:"id" yaml:"-"`
+	Name        string `json:"name" yaml:"name"`
+	Expr        string `json:"expr" yaml:"expr"`
+	Stts        bool   `json:"stts" yaml:"stts"`
+	Parallelism int    `json:"parallelism" yaml:"parallelism,omitempty"`
+	Priority    int    `json:"priority,omitempty" yaml:"priority,omitempty"`
+
+	// Concurrency define o que acontece quando um novo tick chega com
+	// MaxActiveRuns execuções em andamento: "allow", "skip", "queue" ou "replace"
+	Concurrency   string `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	MaxActiveRuns int    `json:"max_active_runs,omitempty" yaml:"max_active_runs,omitempty"`
+
+	// Timeout limita a duração da execução inteira, em segundos. Deadline é
+	// um horário (HH:MM) até o qual a execução precisa terminar
+	Timeout  int    `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Deadline string `json:"deadline,omitempty" yaml:"deadline,omitempty"`
+
+	Params []Param `json:"params,omitempty" yaml:"params,omitempty"`
+
+	// Limits vale para todos os steps; o step pode redefinir cada campo
+	Limits  *Limits  `json:"limits,omitempty" yaml:"limits,omitempty"`
+	Sandbox *Sandbox `json:"sandbox,omitempty" yaml:"sandbox,omitempty"`
+
+	// WorkspaceCleanup decide quando o diretório de trabalho de cada execução
+	// é removido: "always", "on_success" ou "never"
+	WorkspaceCleanup string `json:"workspace_cleanup,omitempty" yaml:"workspace_cleanup,omitempty"`
+
+	Steps []Step     `json:"steps" yaml:"steps"`
+	Next  *time.Time `json:"next,omitempty" yaml:"-"`
+	Prev  *time.Time `json:"prev,omitempty" yaml:"-"`
 }
 
 type Step struct {
-	Name     string   `json:"name" yaml:"name"`
-	Script   string   `json:"script" yaml:"script"`
-	Depends  []string `json:"depends" yaml:"depends"`
-	Timeout  int      `json:"timeout" yaml:"timeout"`
-	Attempts int      `json:"attempts" yaml:"attempts"`
+	Name        string       `json:"name" yaml:"name"`
+	Script      string       `json:"script" yaml:"script,omitempty"`
+	Run         string       `json:"run,omitempty" yaml:"run,omitempty"`
+	Runtime     string       `json:"runtime,omitempty" yaml:"runtime,omitempty"`
+	Depends     []string     `json:"depends" yaml:"depends"`
+	TriggerRule string       `json:"trigger_rule,omitempty" yaml:"trigger_rule,omitempty"`
+	Timeout     int          `json:"timeout" yaml:"timeout"`
+	GracePeriod int          `json:"grace_period,omitempty" yaml:"grace_period,omitempty"`
+	Attempts    int          `json:"attempts" yaml:"attempts"`
+	Retry       *RetryPolicy `json:"retry,omitempty" yaml:"retry,omitempty"`
+	// Artifacts são globs, relativos ao workspace, dos arquivos guardados com
+	// a execução ao fim do step. "**" corresponde a qualquer número de diretórios
+	Artifacts []string `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+	Limits    *Limits  `json:"limits,omitempty" yaml:"limits,omitempty"`
+	// Priority, se definido, substitui a prioridade do workflow na fila global
+	Priority *int `json:"priority,omitempty" yaml:"priority,omitempty"`
+	// Pool é o pool da configuração do servidor cujas vagas o step ocupa
+	// enquanto roda; PoolSlots é quantas, 1 se omitido
+	Pool      string `json:"pool,omitempty" yaml:"pool,omitempty"`
+	PoolSlots int    `json:"pool_slots,omitempty" yaml:"pool_slots,omitempty"`
+	// RunsOn, se definido, envia o step para um agente remoto que tenha
+	// todos esses labels. Exige token de agente configurado no servidor. O
+	// timeout do step passa a contar quando um agente o recebe
+	RunsOn []string `json:"runs_on,omitempty" yaml:"runs_on,omitempty"`
+}
+
+// Sandbox restringe o que os steps podem acessar. User e Group aceitam nome
+// ou id. Isolate (só Linux) dá a cada step um /tmp próprio e a raiz somente
+// leitura fora do workspace, sem rede a menos que Network permita
+type Sandbox struct {
+	User    string `json:"user,omitempty" yaml:"user,omitempty"`
+	Group   string `json:"group,omitempty" yaml:"group,omitempty"`
+	Isolate bool   `json:"isolate,omitempty" yaml:"isolate,omitempty"`
+	Network bool   `json:"network,omitempty" yaml:"network,omitempty"`
+}
+
+// Limits restringe os recursos de cada processo de step. Zero significa sem
+// limite. Memory é em MB e CPU em segundos de processamento
+type Limits struct {
+	Memory    int `json:"memory,omitempty" yaml:"memory,omitempty"`
+	CPU       int `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	OpenFiles int `json:"open_files,omitempty" yaml:"open_files,omitempty"`
+	Processes int `json:"processes,omitempty" yaml:"processes,omitempty"`
+}
+
+// Param declara um parâmetro informado no disparo da execução e repassado a
+// todos os steps como ORCHESTRIUM_PARAM_<NOME>
+type Param struct {
+	Name        string   `json:"name" yaml:"name"`
+	Type        string   `json:"type" yaml:"type"` // "string", "int", "bool", "date", "enum"
+	Default     any      `json:"default,omitempty" yaml:"default,omitempty"`
+	Required    bool     `json:"required,omitempty" yaml:"required,omitempty"`
+	Values      []string `json:"values,omitempty" yaml:"values,omitempty"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// RetryPolicy controla o intervalo entre tentativas de um step e em quais
+// falhas vale tentar de novo. Sem OnExitCodes e OnTimeout, qualquer falha
+// é repetida até esgotar Attempts
+type RetryPolicy struct {
+	Delay       int     `json:"delay" yaml:"delay"`
+	Backoff     string  `json:"backoff" yaml:"backoff"`
+	Jitter      float64 `json:"jitter" yaml:"jitter"`
+	MaxDelay    int     `json:"max_delay" yaml:"max_delay"`
+	OnExitCodes []int   `json:"on_exit_codes,omitempty" yaml:"on_exit_codes,omitempty"`
+	OnTimeout   bool    `json:"on_timeout,omitempty" yaml:"on_timeout,omitempty"`
+}
+
+type SecretRequest struct {
+	Value string `json:"value"`
+}
+
+// SecretInfo descreve um secret sem expor o valor
+type SecretInfo struct {
+	Name      string    `json:"name"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type FileRequest struct {
@@ -35,4 +131,20 @@ type ErrorResponse struct {
 
 type SuccessResponse struct {
 	Message string `json:"message"`
-}
\ No newline at end of file
+}
+
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidationResponse struct {
+	Valid  bool              `json:"valid"`
+	Errors []ValidationError `json:"errors"`
+}
+
+type LogEntry struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+}
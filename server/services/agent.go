@@ -0,0 +1,408 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"orchestrium.sh/config"
+	"orchestrium.sh/models"
+)
+
+// AgentCommand é o subcomando que inicia o processo como agente remoto
+const AgentCommand = "agent"
+
+// errAgentStopping é a causa usada ao interromper o step porque o próprio
+// agente está sendo encerrado
+var errAgentStopping = errors.New("agente encerrado")
+
+// agentClient é o lado do agente: registra-se no servidor, busca steps por
+// long polling, executa cada um localmente e devolve saída e resultado
+type agentClient struct {
+	cfg     *config.Config
+	server  string
+	name    string
+	labels  []string
+	dir     string
+	http    *http.Client
+	session models.AgentSession
+}
+
+// RunAgent executa o modo agente até receber SIGINT ou SIGTERM
+func RunAgent(cfg *config.Config, args []string) error {
+	hostname, _ := os.Hostname()
+
+	flags := flag.NewFlagSet(AgentCommand, flag.ExitOnError)
+	server := flags.String("server", "http://localhost:8080", "endereço do servidor")
+	name := flags.String("name", hostname, "nome do agente")
+	labels := flags.String("labels", "", "labels do agente, separados por vírgula")
+	dir := flags.String("dir", "agent", "diretório dos workspaces dos steps")
+	flags.Parse(args)
+
+	client := &agentClient{
+		cfg:    cfg,
+		server: strings.TrimSuffix(*server, "/"),
+		name:   *name,
+		dir:    *dir,
+		http:   &http.Client{},
+	}
+	for _, label := range strings.Split(*labels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			client.labels = append(client.labels, label)
+		}
+	}
+
+	if err := os.MkdirAll(client.dir, 0755); err != nil {
+		return fmt.Errorf("erro ao criar diretório do agente: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	client.run(ctx)
+	return nil
+}
+
+// run registra o agente e atende steps até o contexto ser encerrado
+func (c *agentClient) run(ctx context.Context) {
+	registered := false
+	defer func() {
+		if registered {
+			c.deregister()
+		}
+	}()
+
+	for ctx.Err() == nil {
+		if !registered {
+			if err := c.register(ctx); err != nil {
+				fmt.Printf("[AGENT] Falha ao registrar em %s: %v\n", c.server, err)
+				sleep(ctx, 5*time.Second)
+				continue
+			}
+			registered = true
+			fmt.Printf("[AGENT %s] Registrado em %s como %s (labels: %s)\n", c.session.Id, c.server, c.name, strings.Join(c.labels, ", "))
+		}
+
+		task, err := c.poll(ctx)
+		if errors.Is(err, errAgentNotFound) {
+			// O servidor reiniciou ou removeu o agente; registra de novo
+			registered = false
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Printf("[AGENT %s] Falha ao buscar steps: %v\n", c.session.Id, err)
+				sleep(ctx, 5*time.Second)
+			}
+			continue
+		}
+		if task != nil {
+			c.execute(ctx, task)
+		}
+	}
+}
+
+// execute roda a tentativa recebida e devolve o resultado ao servidor. Se o
+// agente for encerrado no meio, o resultado não é enviado e o servidor
+// devolve o step à fila ao remover o agente
+func (c *agentClient) execute(ctx context.Context, task *models.AgentTask) {
+	fmt.Printf("[AGENT %s] Executando %s/%s (tentativa %d)\n", c.session.Id, task.WorkflowId, task.Step.Name, task.Attempt)
+
+	taskCtx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel(errAgentStopping)
+		case <-taskCtx.Done():
+		}
+	}()
+
+	logs := &agentLogs{client: c, taskID: task.Id}
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		c.heartbeat(taskCtx, task.Id, cancel, logs)
+	}()
+
+	result := c.runTask(taskCtx, task, logs)
+	cancel(nil)
+	<-heartbeatDone
+
+	switch cause := context.Cause(taskCtx); {
+	case errors.Is(cause, errAgentStopping), errors.Is(cause, errLeaseLost):
+		fmt.Printf("[AGENT %s] Step %s interrompido: %v\n", c.session.Id, task.Step.Name, cause)
+		return
+	}
+
+	if err := logs.flush(); err != nil {
+		fmt.Printf("[AGENT %s] Falha ao enviar logs: %v\n", c.session.Id, err)
+	}
+	if err := c.post(context.Background(), "/tasks/"+task.Id+"/result", result, nil); err != nil {
+		fmt.Printf("[AGENT %s] Falha ao enviar resultado: %v\n", c.session.Id, err)
+		return
+	}
+
+	fmt.Printf("[AGENT %s] Step %s terminou: %s\n", c.session.Id, task.Step.Name, result.Attempt.Status)
+}
+
+// runTask prepara o workspace com os arquivos recebidos e executa o step com
+// a mesma lógica do executor do servidor
+func (c *agentClient) runTask(ctx context.Context, task *models.AgentTask, logs *agentLogs) models.AgentResult {
+	step := &task.Step
+	state := models.AttemptState{
+		Number:    task.Attempt,
+		StartTime: time.Now(),
+	}
+
+	taskDir, _ := filepath.Abs(filepath.Join(c.dir, task.Id))
+	defer os.RemoveAll(taskDir)
+
+	workDir := filepath.Join(taskDir, "workspace")
+	log := &stepLog{}
+	sr := &stepRun{
+		step:       step,
+		workDir:    workDir,
+		log:        log,
+		stdout:     log.Stream(StreamStdout),
+		stderr:     log.Stream(StreamStderr),
+		outputFile: filepath.Join(taskDir, "output.env"),
+	}
+	sr.stdout.onLine = func(line string) { logs.add(StreamStdout, line) }
+	sr.stderr.onLine = func(line string) { logs.add(StreamStderr, line) }
+	if step.Run == "" {
+		sr.scriptPath = filepath.Join(workDir, step.Script)
+	}
+
+	err := writeTaskFiles(workDir, task.Files)
+	if err == nil {
+		err = sr.resetOutputs()
+	}
+	var command []string
+	if err == nil {
+		command, err = resolveCommand(c.cfg, step, sr.scriptPath)
+	}
+	if err != nil {
+		state, _ = failAttempt(state, err)
+		return models.AgentResult{Attempt: state}
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = workDir
+	cmd.Env = append(serverEnv(), task.Env...)
+	cmd.Env = append(cmd.Env,
+		"ORCHESTRIUM_OUTPUT="+sr.outputFile,
+		"ORCHESTRIUM_WORKSPACE="+workDir,
+	)
+
+	name := fmt.Sprintf("%s-%s-%d", task.RunId, safeFileName(step.Name), task.Attempt)
+	state, _ = runProcess(ctx, c.cfg, step, task.Limits, name, cmd, sr.stdout, sr.stderr, state)
+	sr.readOutputFile()
+
+	return models.AgentResult{Attempt: state, Outputs: sr.outputs}
+}
+
+// writeTaskFiles grava os arquivos do workspace recebidos do servidor
+func writeTaskFiles(dir string, files []models.AgentFile) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if !filepath.IsLocal(filepath.FromSlash(file.Path)) {
+			return fmt.Errorf("caminho inválido no workspace: %s", file.Path)
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, file.Data, os.FileMode(file.Mode).Perm()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// heartbeat renova o lease e envia a saída acumulada até o fim do step.
+// Cancela o step se o servidor pedir ou se o lease tiver sido perdido
+func (c *agentClient) heartbeat(ctx context.Context, taskID string, cancel context.CancelCauseFunc, logs *agentLogs) {
+	ticker := time.NewTicker(time.Duration(c.session.HeartbeatInterval) * time.Second)
+	defer ticker.Stop()
+
+	flush := time.NewTicker(time.Second)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flush.C:
+			if err := logs.flush(); errors.Is(err, errLeaseLost) || errors.Is(err, errAgentNotFound) {
+				cancel(errLeaseLost)
+				return
+			}
+		case <-ticker.C:
+			var response models.AgentHeartbeatResponse
+			err := c.post(ctx, "/heartbeat", models.AgentHeartbeat{TaskId: taskID}, &response)
+			switch {
+			case errors.Is(err, errLeaseLost), errors.Is(err, errAgentNotFound):
+				cancel(errLeaseLost)
+				return
+			case err != nil:
+				// Falhas passageiras são toleradas até o lease expirar
+				fmt.Printf("[AGENT %s] Falha no heartbeat: %v\n", c.session.Id, err)
+			case response.Cancel:
+				cancel(errRunCancelled)
+				return
+			}
+		}
+	}
+}
+
+// register registra o agente no servidor
+func (c *agentClient) register(ctx context.Context) error {
+	registration := models.AgentRegistration{Name: c.name, Labels: c.labels}
+	return c.request(ctx, http.MethodPost, c.server+"/agents", registration, &c.session)
+}
+
+// deregister avisa o servidor que o agente está saindo
+func (c *agentClient) deregister() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.request(ctx, http.MethodDelete, c.server+"/agents/"+c.session.Id, nil, nil); err != nil {
+		fmt.Printf("[AGENT %s] Falha ao remover registro: %v\n", c.session.Id, err)
+	}
+}
+
+// poll espera o próximo step; sem step dentro do intervalo, retorna nil
+func (c *agentClient) poll(ctx context.Context) (*models.AgentTask, error) {
+	var task models.AgentTask
+	if err := c.request(ctx, http.MethodGet, c.server+"/agents/"+c.session.Id+"/poll", nil, &task); err != nil {
+		return nil, err
+	}
+	if task.Id == "" {
+		return nil, nil
+	}
+	return &task, nil
+}
+
+// post envia uma requisição para uma rota do próprio agente
+func (c *agentClient) post(ctx context.Context, path string, body any, response any) error {
+	return c.request(ctx, http.MethodPost, c.server+"/agents/"+c.session.Id+path, body, response)
+}
+
+// request faz uma chamada JSON ao servidor. 404 e 409 viram errAgentNotFound
+// e errLeaseLost para que o agente saiba quando registrar de novo ou
+// abandonar o step
+func (c *agentClient) request(ctx context.Context, method string, url string, body any, response any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.AgentToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.AgentToken)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errAgentNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return errLeaseLost
+	case resp.StatusCode == http.StatusNoContent:
+		return nil
+	case resp.StatusCode >= 300:
+		var failure models.ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("servidor respondeu %d: %s", resp.StatusCode, failure.Error)
+	}
+
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// agentLogs acumula as linhas de saída do step até o próximo envio
+type agentLogs struct {
+	client *agentClient
+	taskID string
+	mu     sync.Mutex
+	// send serializa os envios para manter a ordem das linhas
+	send  sync.Mutex
+	lines []models.AgentLogLine
+}
+
+func (l *agentLogs) add(stream string, line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lines = append(l.lines, models.AgentLogLine{Stream: stream, Line: line})
+}
+
+// flush envia as linhas acumuladas ao servidor
+func (l *agentLogs) flush() error {
+	l.send.Lock()
+	defer l.send.Unlock()
+
+	l.mu.Lock()
+	lines := l.lines
+	l.lines = nil
+	l.mu.Unlock()
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	err := l.client.post(context.Background(), "/tasks/"+l.taskID+"/logs", models.AgentLogRequest{Lines: lines}, nil)
+	if err != nil && !errors.Is(err, errLeaseLost) && !errors.Is(err, errAgentNotFound) {
+		// Falha passageira: as linhas voltam para o próximo envio
+		l.mu.Lock()
+		l.lines = append(lines, l.lines...)
+		l.mu.Unlock()
+	}
+	return err
+}
+
+// sleep espera o intervalo ou o fim do contexto
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,596 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"orchestrium.sh/models"
+)
+
+// maxAgentFiles limita o tamanho do workspace enviado a um agente remoto
+const maxAgentFiles = 64 << 20
+
+var (
+	errAgentNotFound = errors.New("agente não encontrado")
+	errLeaseLost     = errors.New("lease expirado")
+)
+
+// agentHub guarda os agentes remotos registrados e as tentativas de step que
+// aguardam ou ocupam um agente. Cada entrega tem um lease renovado pelos
+// heartbeats; quando ele expira, o agente é dado como perdido e o step volta
+// para a fila para rodar em outro agente
+type agentHub struct {
+	mu      sync.Mutex
+	lease   time.Duration
+	agents  map[string]*agentConn
+	pending []*agentTask
+	// wake é fechado e recriado sempre que um step entra na fila, acordando
+	// os agentes em long polling
+	wake chan struct{}
+}
+
+// agentConn é um agente registrado
+type agentConn struct {
+	info models.Agent
+	task *agentTask
+}
+
+// agentTask é uma tentativa de step destinada a um agente
+type agentTask struct {
+	spec       models.AgentTask
+	runsOn     []string
+	enqueued   time.Time
+	agent      *agentConn
+	leaseUntil time.Time
+	requeues   int
+	cancelled  bool
+	// sr recebe as linhas de saída encaminhadas pelo agente
+	sr   *stepRun
+	done chan models.AgentResult
+	// requeued avisa a tentativa que o step voltou para a fila
+	requeued chan struct{}
+}
+
+func newAgentHub(lease time.Duration) *agentHub {
+	hub := &agentHub{
+		lease:  lease,
+		agents: make(map[string]*agentConn),
+		wake:   make(chan struct{}),
+	}
+	go hub.reap()
+	return hub
+}
+
+// session monta os intervalos informados ao agente no registro
+func (h *agentHub) session(id string) models.AgentSession {
+	lease := int(h.lease / time.Second)
+	return models.AgentSession{
+		Id:                id,
+		LeaseTimeout:      lease,
+		HeartbeatInterval: max(1, lease/3),
+		PollWait:          max(1, lease/2),
+	}
+}
+
+// register adiciona um agente e retorna a sessão dele
+func (h *agentHub) register(reg models.AgentRegistration) models.AgentSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	conn := &agentConn{info: models.Agent{
+		Id:           uuid.New().String(),
+		Name:         reg.Name,
+		Labels:       reg.Labels,
+		RegisteredAt: now,
+		LastSeen:     now,
+	}}
+	h.agents[conn.info.Id] = conn
+
+	fmt.Printf("[AGENT %s] Registrado como %s (labels: %s)\n", conn.info.Id, reg.Name, strings.Join(reg.Labels, ", "))
+	return h.session(conn.info.Id)
+}
+
+// deregister remove o agente; o step que ele executava volta para a fila
+func (h *agentHub) deregister(agentID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conn, exists := h.agents[agentID]
+	if !exists {
+		return errAgentNotFound
+	}
+
+	delete(h.agents, agentID)
+	if conn.task != nil {
+		h.requeue(conn.task, fmt.Sprintf("agente %s encerrado", conn.info.Name))
+	}
+
+	fmt.Printf("[AGENT %s] Removido\n", agentID)
+	return nil
+}
+
+// poll entrega ao agente o próximo step compatível com os labels dele,
+// esperando até o intervalo de long polling. Sem step, retorna nil
+func (h *agentHub) poll(ctx context.Context, agentID string) (*models.AgentTask, error) {
+	timer := time.NewTimer(h.lease / 2)
+	defer timer.Stop()
+
+	for {
+		h.mu.Lock()
+		conn, exists := h.agents[agentID]
+		if !exists {
+			h.mu.Unlock()
+			return nil, errAgentNotFound
+		}
+		conn.info.LastSeen = time.Now()
+
+		// O agente ainda não recebeu a entrega anterior, provavelmente
+		// porque a resposta se perdeu
+		if conn.task != nil {
+			spec := conn.task.spec
+			h.mu.Unlock()
+			return &spec, nil
+		}
+
+		for i, task := range h.pending {
+			if !hasLabels(conn.info.Labels, task.runsOn) {
+				continue
+			}
+			h.pending = slices.Delete(h.pending, i, i+1)
+			task.agent = conn
+			task.leaseUntil = time.Now().Add(h.lease)
+			conn.task = task
+			task.sr.log.System("step entregue ao agente %s (%s)", conn.info.Name, conn.info.Id)
+
+			spec := task.spec
+			h.mu.Unlock()
+			return &spec, nil
+		}
+
+		wake := h.wake
+		h.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, nil
+		}
+	}
+}
+
+// task retorna o step entregue ao agente, conferindo se o lease ainda é dele.
+// Deve ser chamada com h.mu travado
+func (h *agentHub) task(agentID string, taskID string) (*agentTask, error) {
+	conn, exists := h.agents[agentID]
+	if !exists {
+		return nil, errAgentNotFound
+	}
+	conn.info.LastSeen = time.Now()
+
+	if taskID == "" {
+		return nil, nil
+	}
+	if conn.task == nil || conn.task.spec.Id != taskID {
+		return nil, errLeaseLost
+	}
+
+	conn.task.leaseUntil = time.Now().Add(h.lease)
+	return conn.task, nil
+}
+
+// heartbeat renova o lease do agente e informa se o step foi cancelado
+func (h *agentHub) heartbeat(agentID string, taskID string) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	task, err := h.task(agentID, taskID)
+	if err != nil || task == nil {
+		return false, err
+	}
+	return task.cancelled, nil
+}
+
+// appendLogs grava no log do step as linhas encaminhadas pelo agente
+func (h *agentHub) appendLogs(agentID string, taskID string, lines []models.AgentLogLine) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	task, err := h.task(agentID, taskID)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return errLeaseLost
+	}
+
+	for _, line := range lines {
+		writer := task.sr.stdout
+		if line.Stream == StreamStderr {
+			writer = task.sr.stderr
+		}
+		writer.Write([]byte(line.Line + "\n"))
+	}
+	return nil
+}
+
+// complete registra o resultado da tentativa e libera o agente
+func (h *agentHub) complete(agentID string, taskID string, result models.AgentResult) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	task, err := h.task(agentID, taskID)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return errLeaseLost
+	}
+
+	task.agent.task = nil
+	task.agent = nil
+	task.done <- result
+	return nil
+}
+
+// submit coloca a tentativa na fila dos agentes
+func (h *agentHub) submit(spec models.AgentTask, sr *stepRun) *agentTask {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	task := &agentTask{
+		spec:     spec,
+		runsOn:   spec.Step.RunsOn,
+		enqueued: time.Now(),
+		sr:       sr,
+		done:     make(chan models.AgentResult, 1),
+		requeued: make(chan struct{}, 1),
+	}
+	h.pending = append(h.pending, task)
+	h.broadcast()
+	return task
+}
+
+// cancel cancela a tentativa. Na fila, ela termina na hora; em um agente, ele
+// é avisado no próximo heartbeat e devolve o resultado
+func (h *agentHub) cancel(task *agentTask) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	task.cancelled = true
+	if task.agent == nil && slices.Contains(h.pending, task) {
+		h.pending = slices.DeleteFunc(h.pending, func(t *agentTask) bool { return t == task })
+		task.done <- cancelledResult()
+	}
+}
+
+// withdraw tira da fila uma tentativa que nenhum agente recebeu. Retorna
+// false se um agente já a recebeu
+func (h *agentHub) withdraw(task *agentTask) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if task.agent != nil || !slices.Contains(h.pending, task) {
+		return false
+	}
+	h.pending = slices.DeleteFunc(h.pending, func(t *agentTask) bool { return t == task })
+	return true
+}
+
+// requeue devolve para o início da fila o step de um agente perdido. Deve
+// ser chamada com h.mu travado
+func (h *agentHub) requeue(task *agentTask, reason string) {
+	task.agent = nil
+	if task.cancelled {
+		task.done <- cancelledResult()
+		return
+	}
+
+	task.requeues++
+	task.sr.stdout.Flush()
+	task.sr.stderr.Flush()
+	task.sr.log.System("%s; step devolvido à fila dos agentes", reason)
+	h.pending = slices.Insert(h.pending, 0, task)
+	h.broadcast()
+
+	select {
+	case task.requeued <- struct{}{}:
+	default:
+	}
+}
+
+// broadcast acorda os agentes em long polling. Deve ser chamada com h.mu travado
+func (h *agentHub) broadcast() {
+	close(h.wake)
+	h.wake = make(chan struct{})
+}
+
+// reap remove periodicamente os agentes que pararam de dar sinal. O step de
+// um agente com lease expirado volta para a fila
+func (h *agentHub) reap() {
+	ticker := time.NewTicker(max(time.Second, h.lease/4))
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.expire(now)
+	}
+}
+
+// expire remove os agentes sem sinal até now e devolve para a fila os
+// steps dos que estavam com lease expirado
+func (h *agentHub) expire(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, conn := range h.agents {
+		if conn.task != nil && now.After(conn.task.leaseUntil) {
+			delete(h.agents, id)
+			h.requeue(conn.task, fmt.Sprintf("agente %s sem heartbeat há mais de %s", conn.info.Name, h.lease))
+			fmt.Printf("[AGENT %s] Lease expirado; agente removido\n", id)
+		} else if conn.task == nil && now.Sub(conn.info.LastSeen) > h.lease {
+			delete(h.agents, id)
+			fmt.Printf("[AGENT %s] Sem sinal há mais de %s; agente removido\n", id, h.lease)
+		}
+	}
+}
+
+// list monta o retrato dos agentes e da fila
+func (h *agentHub) list() models.AgentList {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := models.AgentList{
+		Agents:  make([]models.Agent, 0, len(h.agents)),
+		Pending: make([]models.AgentTaskRef, 0, len(h.pending)),
+	}
+
+	for _, conn := range h.agents {
+		agent := conn.info
+		agent.Status = "idle"
+		if conn.task != nil {
+			agent.Status = "busy"
+			agent.Task = conn.task.ref()
+		}
+		list.Agents = append(list.Agents, agent)
+	}
+	sort.Slice(list.Agents, func(i, j int) bool {
+		return list.Agents[i].RegisteredAt.Before(list.Agents[j].RegisteredAt)
+	})
+
+	for _, task := range h.pending {
+		list.Pending = append(list.Pending, *task.ref())
+	}
+
+	return list
+}
+
+// ref resume a tentativa para a listagem. Deve ser chamada com h.mu travado
+func (t *agentTask) ref() *models.AgentTaskRef {
+	ref := &models.AgentTaskRef{
+		Id:         t.spec.Id,
+		WorkflowId: t.spec.WorkflowId,
+		RunId:      t.spec.RunId,
+		Step:       t.spec.Step.Name,
+		Attempt:    t.spec.Attempt,
+		RunsOn:     t.runsOn,
+		EnqueuedAt: t.enqueued,
+		Requeues:   t.requeues,
+	}
+	if t.agent != nil {
+		lease := t.leaseUntil
+		ref.LeaseExpires = &lease
+	}
+	return ref
+}
+
+// cancelledResult é o resultado de uma tentativa cancelada antes de o agente
+// devolver o próprio
+func cancelledResult() models.AgentResult {
+	return models.AgentResult{Attempt: models.AttemptState{
+		Status:   "cancelled",
+		ExitCode: -1,
+		Error:    errRunCancelled.Error(),
+	}}
+}
+
+// hasLabels indica se o agente tem todos os labels pedidos pelo step
+func hasLabels(labels []string, required []string) bool {
+	for _, label := range required {
+		if !slices.Contains(labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// workspaceFiles lê os arquivos do workspace para enviar ao agente
+func workspaceFiles(dir string) ([]models.AgentFile, error) {
+	files := make([]models.AgentFile, 0)
+	var total int64
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		if total > maxAgentFiles {
+			return fmt.Errorf("workspace maior que %d MB", maxAgentFiles>>20)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, models.AgentFile{
+			Path: filepath.ToSlash(rel),
+			Mode: uint32(info.Mode().Perm()),
+			Data: data,
+		})
+		return nil
+	})
+
+	return files, err
+}
+
+// remoteAttempt executa a tentativa em um agente remoto com os labels de
+// runs_on e espera o resultado. A saída chega pelo log do step e os outputs
+// junto com o resultado
+func (we *WorkflowExecutor) remoteAttempt(ctx context.Context, sr *stepRun, state models.AttemptState) (models.AttemptState, error) {
+	step := sr.step
+
+	if we.agents == nil || we.config.AgentToken == "" {
+		return failAttempt(state, fmt.Errorf("agentes remotos indisponíveis"))
+	}
+
+	files, err := workspaceFiles(sr.workDir)
+	if err != nil {
+		return failAttempt(state, fmt.Errorf("erro ao ler workspace: %w", err))
+	}
+
+	sr.log.System("aguardando agente com labels: %s", strings.Join(step.RunsOn, ", "))
+	task := we.agents.submit(models.AgentTask{
+		Id:         uuid.New().String(),
+		WorkflowId: we.workflowID,
+		RunId:      we.runID,
+		Attempt:    state.Number,
+		Step:       *step,
+		Files:      files,
+		Env:        we.runEnv(step),
+		Limits:     we.stepLimits(step),
+	}, sr)
+
+	// Sem agente compatível, a tentativa falha depois de agent_wait em vez de
+	// segurar a vaga do step indefinidamente. A espera recomeça sempre que o
+	// step volta para a fila porque o agente dele foi perdido
+	wait := time.Duration(we.config.AgentWait) * time.Second
+	dispatch := time.NewTimer(wait)
+	defer dispatch.Stop()
+
+	var result models.AgentResult
+	for received := false; !received; {
+		select {
+		case result = <-task.done:
+			received = true
+		case <-ctx.Done():
+			we.agents.cancel(task)
+			result = <-task.done
+			received = true
+		case <-task.requeued:
+			dispatch.Reset(wait)
+		case <-dispatch.C:
+			if we.agents.withdraw(task) {
+				state.TimedOut = true
+				return failAttempt(state, fmt.Errorf("nenhum agente com labels %s disponível em %s", strings.Join(step.RunsOn, ", "), wait))
+			}
+		}
+	}
+
+	sr.stdout.Flush()
+	sr.stderr.Flush()
+
+	// Os outputs do arquivo têm precedência sobre os do marcador no stdout
+	sr.log.mu.Lock()
+	for key, value := range result.Outputs {
+		sr.outputs[key] = sr.log.redact(value)
+	}
+	sr.log.mu.Unlock()
+
+	remote := result.Attempt
+	state.Status = remote.Status
+	state.ExitCode = remote.ExitCode
+	state.TimedOut = remote.TimedOut
+	state.Signal = remote.Signal
+	state.LimitExceeded = remote.LimitExceeded
+	state.Error = remote.Error
+	state.EndTime = time.Now()
+	state.Duration = state.EndTime.Sub(state.StartTime)
+
+	if ctx.Err() != nil {
+		err = context.Cause(ctx)
+		state.Status = "cancelled"
+		state.Error = err.Error()
+		return state, err
+	}
+
+	if state.Status != "success" {
+		if state.Error == "" {
+			state.Error = "falha no agente remoto"
+		}
+		return state, errors.New(state.Error)
+	}
+
+	return state, nil
+}
+
+// RegisterAgent registra um agente remoto
+func (ws *WorkflowService) RegisterAgent(reg models.AgentRegistration) models.AgentSession {
+	return ws.agents.register(reg)
+}
+
+// DeregisterAgent remove um agente remoto
+func (ws *WorkflowService) DeregisterAgent(agentID string) error {
+	return ws.agents.deregister(agentID)
+}
+
+// PollAgent espera um step para o agente
+func (ws *WorkflowService) PollAgent(ctx context.Context, agentID string) (*models.AgentTask, error) {
+	return ws.agents.poll(ctx, agentID)
+}
+
+// AgentHeartbeat renova o lease do agente e informa se o step foi cancelado
+func (ws *WorkflowService) AgentHeartbeat(agentID string, taskID string) (bool, error) {
+	return ws.agents.heartbeat(agentID, taskID)
+}
+
+// AppendAgentLogs grava a saída encaminhada pelo agente
+func (ws *WorkflowService) AppendAgentLogs(agentID string, taskID string, lines []models.AgentLogLine) error {
+	return ws.agents.appendLogs(agentID, taskID, lines)
+}
+
+// CompleteAgentTask registra o resultado de um step executado pelo agente
+func (ws *WorkflowService) CompleteAgentTask(agentID string, taskID string, result models.AgentResult) error {
+	return ws.agents.complete(agentID, taskID, result)
+}
+
+// ListAgents lista os agentes registrados e os steps aguardando um agente
+func (ws *WorkflowService) ListAgents() models.AgentList {
+	return ws.agents.list()
+}
+
+// AgentsEnabled indica se o servidor aceita agentes remotos. Os agentes
+// recebem secrets e o workspace, então só são aceitos com token configurado
+func (ws *WorkflowService) AgentsEnabled() bool {
+	return ws.config.AgentToken != ""
+}
+
+// CheckAgentToken confere o token enviado por um agente
+func (ws *WorkflowService) CheckAgentToken(token string) bool {
+	if !ws.AgentsEnabled() {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(ws.config.AgentToken)) == 1
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"orchestrium.sh/config"
+	"orchestrium.sh/models"
+)
+
+// testAgentHub cria o hub sem a goroutine de reap, para que os testes
+// controlem quando os leases expiram
+func testAgentHub(lease time.Duration) *agentHub {
+	return &agentHub{
+		lease:  lease,
+		agents: make(map[string]*agentConn),
+		wake:   make(chan struct{}),
+	}
+}
+
+// testStepRun monta um stepRun que descarta o log
+func testStepRun() *stepRun {
+	log := &stepLog{}
+	return &stepRun{log: log, stdout: log.Stream(StreamStdout), stderr: log.Stream(StreamStderr)}
+}
+
+// pollNow pede um step sem esperar o long polling
+func pollNow(t *testing.T, hub *agentHub, agentID string) *models.AgentTask {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	spec, err := hub.poll(ctx, agentID)
+	if err != nil {
+		t.Fatalf("poll(%s): %v", agentID, err)
+	}
+	return spec
+}
+
+func TestAgentHubRequeueOnLeaseExpiry(t *testing.T) {
+	hub := testAgentHub(30 * time.Second)
+	first := hub.register(models.AgentRegistration{Name: "first", Labels: []string{"gpu", "linux"}})
+	other := hub.register(models.AgentRegistration{Name: "other", Labels: []string{"linux"}})
+	second := hub.register(models.AgentRegistration{Name: "second", Labels: []string{"gpu"}})
+
+	task := hub.submit(models.AgentTask{Id: "t1", Step: models.Step{Name: "train", RunsOn: []string{"gpu"}}}, testStepRun())
+
+	if spec := pollNow(t, hub, other.Id); spec != nil {
+		t.Fatalf("agente sem o label recebeu %s", spec.Id)
+	}
+	if spec := pollNow(t, hub, first.Id); spec == nil || spec.Id != "t1" {
+		t.Fatalf("first não recebeu t1: %v", spec)
+	}
+	if spec := pollNow(t, hub, second.Id); spec != nil {
+		t.Fatalf("t1 entregue a dois agentes")
+	}
+
+	// O heartbeat renova o lease; antes de expirar, nada muda
+	if _, err := hub.heartbeat(first.Id, "t1"); err != nil {
+		t.Fatal(err)
+	}
+	hub.expire(time.Now().Add(hub.lease / 2))
+	if task.agent == nil || task.requeues != 0 {
+		t.Fatalf("step devolvido antes do lease expirar")
+	}
+
+	// Sem heartbeat até o fim do lease, o agente é removido e o step volta;
+	// os demais agentes, que deram sinal, continuam registrados
+	task.leaseUntil = time.Now().Add(-time.Second)
+	hub.expire(time.Now())
+	if len(hub.agents) != 2 {
+		t.Fatalf("agentes = %d; esperado 2", len(hub.agents))
+	}
+	if task.requeues != 1 || task.agent != nil || len(hub.pending) != 1 {
+		t.Fatalf("requeues=%d agent=%v pending=%d; esperado step de volta na fila", task.requeues, task.agent, len(hub.pending))
+	}
+	if _, err := hub.heartbeat(first.Id, "t1"); !errors.Is(err, errAgentNotFound) {
+		t.Fatalf("heartbeat do agente perdido = %v; esperado %v", err, errAgentNotFound)
+	}
+
+	if spec := pollNow(t, hub, second.Id); spec == nil || spec.Id != "t1" {
+		t.Fatalf("second não recebeu t1 após o requeue: %v", spec)
+	}
+
+	result := models.AgentResult{Attempt: models.AttemptState{Status: "success"}}
+	if err := hub.complete(second.Id, "t1", result); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-task.done; got.Attempt.Status != "success" {
+		t.Fatalf("resultado = %q; esperado success", got.Attempt.Status)
+	}
+}
+
+func TestAgentHubCancelledTaskNotRequeued(t *testing.T) {
+	hub := testAgentHub(30 * time.Second)
+	agent := hub.register(models.AgentRegistration{Name: "agent"})
+
+	task := hub.submit(models.AgentTask{Id: "t1", Step: models.Step{Name: "step"}}, testStepRun())
+	if spec := pollNow(t, hub, agent.Id); spec == nil {
+		t.Fatal("agente não recebeu o step")
+	}
+
+	// Cancelado em um agente, o step espera o agente; se ele sumir, a
+	// tentativa termina cancelada em vez de voltar para a fila
+	hub.cancel(task)
+	task.leaseUntil = time.Now().Add(-time.Second)
+	hub.expire(time.Now())
+
+	if len(hub.pending) != 0 || task.requeues != 0 {
+		t.Fatalf("step cancelado voltou para a fila")
+	}
+	if got := <-task.done; got.Attempt.Status != "cancelled" {
+		t.Fatalf("resultado = %q; esperado cancelled", got.Attempt.Status)
+	}
+}
+
+func TestAgentHubExpireIdleAgent(t *testing.T) {
+	hub := testAgentHub(30 * time.Second)
+	agent := hub.register(models.AgentRegistration{Name: "idle"})
+
+	hub.expire(time.Now().Add(hub.lease / 2))
+	if _, exists := hub.agents[agent.Id]; !exists {
+		t.Fatalf("agente removido antes do lease")
+	}
+
+	hub.expire(time.Now().Add(hub.lease + time.Second))
+	if _, exists := hub.agents[agent.Id]; exists {
+		t.Fatalf("agente sem sinal não foi removido")
+	}
+}
+
+func TestRemoteAttemptWaitsAgainAfterRequeue(t *testing.T) {
+	hub := testAgentHub(30 * time.Second)
+	we := &WorkflowExecutor{
+		config: &config.Config{AgentToken: "token", AgentWait: 1},
+		agents: hub,
+	}
+	step := &models.Step{Name: "train", RunsOn: []string{"gpu"}}
+	sr := testStepRun()
+	sr.step = step
+	sr.workDir = t.TempDir()
+	sr.outputs = make(map[string]string)
+
+	type attempt struct {
+		state models.AttemptState
+		err   error
+	}
+	finished := make(chan attempt, 1)
+	go func() {
+		state, err := we.remoteAttempt(context.Background(), sr, models.AttemptState{Number: 1, StartTime: time.Now()})
+		finished <- attempt{state, err}
+	}()
+
+	agent := hub.register(models.AgentRegistration{Name: "gpu", Labels: []string{"gpu"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if spec, err := hub.poll(ctx, agent.Id); err != nil || spec == nil {
+		t.Fatalf("agente não recebeu o step: %v %v", spec, err)
+	}
+
+	// agent_wait passa com o step no agente, que então é perdido; sem outro
+	// agente, a tentativa falha depois de uma nova espera
+	time.Sleep(1200 * time.Millisecond)
+	hub.mu.Lock()
+	hub.agents[agent.Id].task.leaseUntil = time.Now().Add(-time.Second)
+	hub.mu.Unlock()
+	hub.expire(time.Now())
+
+	select {
+	case result := <-finished:
+		if result.err == nil || !result.state.TimedOut {
+			t.Fatalf("tentativa = %+v, %v; esperado timeout sem agente", result.state, result.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tentativa não terminou depois do requeue sem agente")
+	}
+
+	if len(hub.pending) != 0 {
+		t.Fatalf("step continua na fila dos agentes")
+	}
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"orchestrium.sh/models"
+)
+
+// artifactsDir retorna onde ficam os artifacts de um step na execução
+func artifactsDir(workflowID string, runID string, stepName string) string {
+	return filepath.Join(runDir(workflowID, runID), "artifacts", safeFileName(stepName))
+}
+
+// validateArtifactPattern confere se o padrão é um glob válido relativo ao workspace
+func validateArtifactPattern(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("padrão vazio")
+	}
+	if path.IsAbs(pattern) || filepath.IsAbs(pattern) {
+		return fmt.Errorf("use um caminho relativo ao workspace")
+	}
+	for _, part := range strings.Split(pattern, "/") {
+		if part == ".." {
+			return fmt.Errorf("padrão não pode sair do workspace")
+		}
+		if _, err := path.Match(part, ""); err != nil {
+			return fmt.Errorf("padrão inválido: %s", pattern)
+		}
+	}
+	return nil
+}
+
+// matchGlob compara um caminho relativo com o padrão, segmento por segmento.
+// Além dos curingas de path.Match, "**" corresponde a qualquer número de diretórios
+func matchGlob(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlob(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// collectArtifacts copia para a execução os arquivos do workspace que
+// correspondem aos padrões do step, registrando tamanho e sha256. Links
+// simbólicos são ignorados para não copiar nada de fora do workspace
+func (we *WorkflowExecutor) collectArtifacts(step *models.Step, workDir string, log *stepLog) []models.Artifact {
+	patterns := make([][]string, 0, len(step.Artifacts))
+	for _, pattern := range step.Artifacts {
+		patterns = append(patterns, strings.Split(path.Clean(pattern), "/"))
+	}
+
+	dest := artifactsDir(we.workflowID, we.runID, step.Name)
+	artifacts := make([]models.Artifact, 0)
+
+	err := filepath.WalkDir(workDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(workDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		matched := false
+		for _, pattern := range patterns {
+			if matchGlob(pattern, strings.Split(rel, "/")) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil
+		}
+
+		size, sum, err := copyArtifact(file, filepath.Join(dest, filepath.FromSlash(rel)))
+		if err != nil {
+			log.System("erro ao copiar artifact %s: %v", rel, err)
+			return nil
+		}
+
+		artifacts = append(artifacts, models.Artifact{Step: step.Name, Path: rel, Size: size, SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		log.System("erro ao procurar artifacts: %v", err)
+	}
+
+	if len(artifacts) == 0 {
+		log.System("nenhum artifact corresponde a %s", strings.Join(step.Artifacts, ", "))
+	} else {
+		log.System("%d artifact(s) coletado(s)", len(artifacts))
+	}
+
+	return artifacts
+}
+
+// copyArtifact copia o arquivo calculando o sha256 no caminho
+func copyArtifact(src string, dst string) (int64, string, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, "", err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, "", err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, "", err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), in)
+	if err != nil {
+		out.Close()
+		return 0, "", err
+	}
+	if err := out.Close(); err != nil {
+		return 0, "", err
+	}
+
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// pruneArtifacts remove os artifacts das execuções mais antigas do workflow
+// até o total caber no limite configurado. Execuções em andamento e a atual
+// são preservadas; as podadas continuam listando os artifacts como expirados
+func (we *WorkflowExecutor) pruneArtifacts() {
+	limit := int64(we.config.ArtifactsMaxMB) * 1024 * 1024
+	if limit <= 0 {
+		return
+	}
+
+	runs := loadRuns(we.workflowID)
+
+	var total int64
+	for _, run := range runs {
+		total += artifactsSize(&run)
+	}
+
+	// loadRuns ordena da mais recente para a mais antiga
+	for i := len(runs) - 1; i >= 0 && total > limit; i-- {
+		run := &runs[i]
+		size := artifactsSize(run)
+		if size == 0 || run.Id == we.runID {
+			continue
+		}
+		switch run.Status {
+		case "pending", "queued", "running":
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(runDir(we.workflowID, run.Id), "artifacts")); err != nil {
+			fmt.Printf("[WORKFLOW %s] Erro ao remover artifacts da execução %s: %v\n", we.workflowID, run.Id, err)
+			continue
+		}
+
+		for s := range run.Steps {
+			for a := range run.Steps[s].Artifacts {
+				run.Steps[s].Artifacts[a].Expired = true
+			}
+		}
+		if err := saveRun(run); err != nil {
+			fmt.Printf("[WORKFLOW %s] Erro ao atualizar execução %s: %v\n", we.workflowID, run.Id, err)
+		}
+
+		total -= size
+		fmt.Printf("[WORKFLOW %s] Artifacts da execução %s removidos pela retenção\n", we.workflowID, run.Id)
+	}
+}
+
+// artifactsSize soma o tamanho dos artifacts ainda guardados de uma execução
+func artifactsSize(run *models.Run) int64 {
+	var size int64
+	for _, step := range run.Steps {
+		for _, artifact := range step.Artifacts {
+			if !artifact.Expired {
+				size += artifact.Size
+			}
+		}
+	}
+	return size
+}
+
+// ListArtifacts retorna os artifacts de todos os steps de uma execução
+func (ws *WorkflowService) ListArtifacts(id string, runID string) ([]models.Artifact, error) {
+	run, err := ws.GetRun(id, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := make([]models.Artifact, 0)
+	for _, step := range run.Steps {
+		artifacts = append(artifacts, step.Artifacts...)
+	}
+
+	return artifacts, nil
+}
+
+// GetArtifactPath localiza o arquivo de um artifact para download. Só são
+// servidos caminhos registrados na execução
+func (ws *WorkflowService) GetArtifactPath(id string, runID string, stepName string, artifactPath string) (string, error) {
+	run, err := ws.GetRun(id, runID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, step := range run.Steps {
+		if step.StepName != stepName {
+			continue
+		}
+		for _, artifact := range step.Artifacts {
+			if artifact.Path != artifactPath {
+				continue
+			}
+			if artifact.Expired {
+				return "", fmt.Errorf("artifact expirado")
+			}
+			return filepath.Join(artifactsDir(id, runID, stepName), filepath.FromSlash(artifact.Path)), nil
+		}
+	}
+
+	return "", fmt.Errorf("artifact não encontrado")
+}
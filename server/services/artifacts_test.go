@@ -0,0 +1,142 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"orchestrium.sh/config"
+	"orchestrium.sh/models"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"report.csv", "report.csv", true},
+		{"*.csv", "report.csv", true},
+		{"*.csv", "out/report.csv", false},
+		{"out/*.csv", "out/report.csv", true},
+		{"**/*.csv", "report.csv", true},
+		{"**/*.csv", "a/b/c/report.csv", true},
+		{"**/*.csv", "a/b/report.json", false},
+		{"out/**", "out/a/b.txt", true},
+		{"out/**", "other/b.txt", false},
+		{"out/**/final/*.png", "out/final/x.png", true},
+		{"out/**/final/*.png", "out/2026/01/final/x.png", true},
+		{"out/**/final/*.png", "out/2026/final/sub/x.png", false},
+		{"**", "qualquer/coisa", true},
+	}
+
+	for _, tt := range tests {
+		got := matchGlob(strings.Split(tt.pattern, "/"), strings.Split(tt.name, "/"))
+		if got != tt.expected {
+			t.Errorf("matchGlob(%s, %s) = %v; esperado %v", tt.pattern, tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestValidateArtifactPattern(t *testing.T) {
+	valid := []string{"report.csv", "out/*.json", "**/*.png", "dist/**"}
+	for _, pattern := range valid {
+		if err := validateArtifactPattern(pattern); err != nil {
+			t.Errorf("validateArtifactPattern(%q): %v", pattern, err)
+		}
+	}
+
+	invalid := []string{"", "  ", "/etc/passwd", "../secret", "out/../../x", "out/[a.txt"}
+	for _, pattern := range invalid {
+		if err := validateArtifactPattern(pattern); err == nil {
+			t.Errorf("validateArtifactPattern(%q) aceito", pattern)
+		}
+	}
+}
+
+func TestPruneArtifacts(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	cfg := *config.Default()
+	cfg.ArtifactsMaxMB = 1
+	executor := NewWorkflowExecutor("wf", &models.WorkflowResponse{Name: "wf"}, models.TriggerManual, nil, &cfg)
+
+	// Cada execução guarda 400KB; o total passa de 1MB
+	now := time.Now()
+	runs := []models.Run{
+		{Id: "oldest", Status: "success", CreatedAt: now.Add(-5 * time.Hour)},
+		{Id: "running", Status: "running", CreatedAt: now.Add(-4 * time.Hour)},
+		{Id: "old", Status: "failed", CreatedAt: now.Add(-3 * time.Hour)},
+		{Id: "recent", Status: "success", CreatedAt: now.Add(-2 * time.Hour)},
+		{Id: executor.runID, Status: "running", CreatedAt: now.Add(-1 * time.Hour)},
+	}
+	for i := range runs {
+		runs[i].WorkflowId = "wf"
+		runs[i].Steps = []models.ExecutionState{{
+			StepName:  "build",
+			Artifacts: []models.Artifact{{Step: "build", Path: "out.bin", Size: 400 * 1024}},
+		}}
+		dir := artifactsDir("wf", runs[i].Id, "build")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "out.bin"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := saveRun(&runs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	executor.pruneArtifacts()
+
+	// Das 2000KB, saem as três execuções terminadas até sobrarem 800KB; a
+	// execução em andamento no meio delas e a atual são preservadas
+	expired := map[string]bool{"oldest": true, "running": false, "old": true, "recent": true, executor.runID: false}
+	for _, run := range loadRuns("wf") {
+		_, err := os.Stat(filepath.Join(runDir("wf", run.Id), "artifacts"))
+		if expired[run.Id] {
+			if !run.Steps[0].Artifacts[0].Expired || !os.IsNotExist(err) {
+				t.Errorf("artifacts da execução %s não removidos", run.Id)
+			}
+		} else if run.Steps[0].Artifacts[0].Expired || err != nil {
+			t.Errorf("artifacts da execução %s removidos", run.Id)
+		}
+	}
+}
+
+func TestPruneArtifactsStopsWithinLimit(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	cfg := *config.Default()
+	cfg.ArtifactsMaxMB = 1
+	executor := NewWorkflowExecutor("wf", &models.WorkflowResponse{Name: "wf"}, models.TriggerManual, nil, &cfg)
+
+	now := time.Now()
+	for i, id := range []string{"a", "b", "c"} {
+		run := models.Run{
+			Id:         id,
+			WorkflowId: "wf",
+			Status:     "success",
+			CreatedAt:  now.Add(time.Duration(i) * time.Hour),
+			Steps: []models.ExecutionState{{
+				StepName:  "build",
+				Artifacts: []models.Artifact{{Step: "build", Path: "out.bin", Size: 400 * 1024}},
+			}},
+		}
+		if err := saveRun(&run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	executor.pruneArtifacts()
+
+	// Basta remover a mais antiga para o total cair para 800KB
+	for _, run := range loadRuns("wf") {
+		if expired := run.Steps[0].Artifacts[0].Expired; expired != (run.Id == "a") {
+			t.Errorf("execução %s com artifacts expirados = %v", run.Id, expired)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"orchestrium.sh/models"
+)
+
+const (
+	ConcurrencyAllow   = "allow"
+	ConcurrencySkip    = "skip"
+	ConcurrencyQueue   = "queue"
+	ConcurrencyReplace = "replace"
+)
+
+// errRunReplaced é a causa usada ao cancelar uma execução substituída por
+// outra na política replace
+var errRunReplaced = errors.New("execução substituída por uma mais recente")
+
+// activeRun é uma execução em andamento ou na fila que ainda pode ser cancelada
+type activeRun struct {
+	executor *WorkflowExecutor
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	queued   bool
+}
+
+// launch aplica a política de concorrência do workflow à nova execução: ela
+// inicia imediatamente se houver vaga em max_active_runs e, caso contrário,
+// é descartada, enfileirada ou substitui as execuções em andamento. Retorna o
+// status com que a execução ficou
+func (ws *WorkflowService) launch(executor *WorkflowExecutor) string {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	id := executor.workflowID
+	limit := executor.maxActiveRuns
+
+	if limit == 0 || (ws.runningCount(id) < limit && len(ws.queues[id]) == 0) {
+		ws.startRun(ws.newActiveRun(executor))
+		return "running"
+	}
+
+	switch executor.concurrency {
+	case ConcurrencySkip:
+		executor.abort("skipped", "Execução anterior ainda em andamento")
+		fmt.Printf("[WORKFLOW %s] Execução %s descartada (execução anterior em andamento)\n", id, executor.RunID())
+		return "skipped"
+
+	case ConcurrencyReplace:
+		// As execuções na fila também perdem a vez para a mais recente
+		for _, queued := range ws.queues[id] {
+			delete(ws.active, queued.executor.RunID())
+			queued.cancel(errRunReplaced)
+			queued.executor.abort("cancelled", errRunReplaced.Error())
+		}
+		ws.queues[id] = nil
+
+		for _, run := range ws.active {
+			if run.executor.workflowID == id && !run.queued {
+				run.cancel(errRunReplaced)
+			}
+		}
+		fmt.Printf("[WORKFLOW %s] Execução %s substitui as execuções em andamento\n", id, executor.RunID())
+	}
+
+	// allow, queue e replace aguardam uma vaga
+	run := ws.newActiveRun(executor)
+	run.queued = true
+	ws.queues[id] = append(ws.queues[id], run)
+	executor.markQueued()
+	fmt.Printf("[WORKFLOW %s] Execução %s na fila (%d aguardando)\n", id, executor.RunID(), len(ws.queues[id]))
+	return "queued"
+}
+
+// newActiveRun registra a execução como ativa com o contexto que a cancela.
+// Deve ser chamada com ws.mu travado
+func (ws *WorkflowService) newActiveRun(executor *WorkflowExecutor) *activeRun {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	run := &activeRun{executor: executor, ctx: ctx, cancel: cancel}
+	ws.active[executor.RunID()] = run
+	return run
+}
+
+// runningCount conta as execuções do workflow que já saíram da fila. Deve ser
+// chamada com ws.mu travado
+func (ws *WorkflowService) runningCount(id string) int {
+	count := 0
+	for _, run := range ws.active {
+		if run.executor.workflowID == id && !run.queued {
+			count++
+		}
+	}
+	return count
+}
+
+// startRun executa o workflow em segundo plano. Deve ser chamada com ws.mu travado
+func (ws *WorkflowService) startRun(run *activeRun) {
+	run.queued = false
+
+	// Grava o registro antes de voltar, para que o id já possa ser consultado
+	run.executor.persist()
+	go ws.runExecutor(run)
+}
+
+// runExecutor executa o workflow a partir de src/, registra falhas no console
+// e, ao terminar, libera a vaga para a próxima execução da fila
+func (ws *WorkflowService) runExecutor(run *activeRun) {
+	executor := run.executor
+	defer ws.finishRun(run)
+
+	srcPath := filepath.Join("workflows", executor.workflowID, "src")
+
+	if err := executor.Execute(run.ctx, srcPath); err != nil && !errors.Is(err, errRunCancelled) && !errors.Is(err, errRunReplaced) {
+		fmt.Printf("[WORKFLOW %s] Erro na execução: %v\n", executor.workflowID, err)
+	}
+}
+
+// finishRun remove a execução das ativas e inicia as próximas da fila
+// enquanto houver vaga
+func (ws *WorkflowService) finishRun(run *activeRun) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	run.cancel(nil)
+	delete(ws.active, run.executor.RunID())
+
+	id := run.executor.workflowID
+	for len(ws.queues[id]) > 0 {
+		next := ws.queues[id][0]
+		if next.executor.maxActiveRuns > 0 && ws.runningCount(id) >= next.executor.maxActiveRuns {
+			break
+		}
+		ws.queues[id] = ws.queues[id][1:]
+		ws.startRun(next)
+	}
+
+	if len(ws.queues[id]) == 0 {
+		delete(ws.queues, id)
+	}
+}
+
+// removeQueued tira uma execução da fila do workflow. Deve ser chamada com ws.mu travado
+func (ws *WorkflowService) removeQueued(run *activeRun) {
+	id := run.executor.workflowID
+	for i, queued := range ws.queues[id] {
+		if queued == run {
+			ws.queues[id] = append(ws.queues[id][:i], ws.queues[id][i+1:]...)
+			break
+		}
+	}
+	delete(ws.active, run.executor.RunID())
+}
+
+// CancelRun cancela uma execução em andamento, encerrando o step que estiver
+// rodando e impedindo que os próximos iniciem. Execuções na fila são
+// removidas sem chegar a rodar
+func (ws *WorkflowService) CancelRun(id string, runID string) error {
+	if _, err := os.Stat(filepath.Join("workflows", id, "conf.yaml")); err != nil {
+		return fmt.Errorf("workflow não encontrado")
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	run, exists := ws.active[runID]
+	if !exists || run.executor.workflowID != id {
+		if _, err := ws.GetRun(id, runID); err != nil {
+			return err
+		}
+		return fmt.Errorf("execução não está em andamento")
+	}
+
+	ws.cancelRun(run)
+	fmt.Printf("[WORKFLOW %s] Cancelamento da execução %s solicitado\n", id, runID)
+	return nil
+}
+
+// cancelRun cancela uma execução ativa ou remove da fila. Deve ser chamada
+// com ws.mu travado
+func (ws *WorkflowService) cancelRun(run *activeRun) {
+	run.cancel(errRunCancelled)
+	if run.queued {
+		ws.removeQueued(run)
+		run.executor.abort("cancelled", errRunCancelled.Error())
+	}
+}
+
+// cancelActiveRuns cancela todas as execuções em andamento ou na fila de um workflow
+func (ws *WorkflowService) cancelActiveRuns(id string) int {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	cancelled := 0
+	for _, run := range ws.active {
+		if run.executor.workflowID == id {
+			ws.cancelRun(run)
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+// concurrencyDefaults resolve a política e o limite de execuções simultâneas
+// do workflow. Sem política vale allow, que sem max_active_runs permite
+// qualquer número de execuções; as demais políticas limitam a uma por padrão
+func concurrencyDefaults(workflow *models.WorkflowResponse) (string, int) {
+	policy := workflow.Concurrency
+	if policy == "" {
+		policy = ConcurrencyAllow
+	}
+
+	limit := workflow.MaxActiveRuns
+	if limit <= 0 && policy != ConcurrencyAllow {
+		limit = 1
+	}
+
+	return policy, limit
+}
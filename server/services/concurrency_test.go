@@ -0,0 +1,183 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"orchestrium.sh/config"
+	"orchestrium.sh/models"
+)
+
+// concurrencyTest monta o serviço em um diretório temporário. Os steps das
+// execuções ficam rodando até release ser chamada
+type concurrencyTest struct {
+	t       *testing.T
+	ws      *WorkflowService
+	release func()
+	step    string
+}
+
+func newConcurrencyTest(t *testing.T) *concurrencyTest {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	if err := os.MkdirAll(filepath.Join("workflows", "wf", "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	flag := filepath.Join(dir, "release")
+	ct := &concurrencyTest{
+		t: t,
+		ws: &WorkflowService{
+			config: config.Default(),
+			active: make(map[string]*activeRun),
+			queues: make(map[string][]*activeRun),
+		},
+		step: "while [ ! -f " + flag + " ]; do sleep 0.02; done",
+	}
+	ct.release = func() {
+		if err := os.WriteFile(flag, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(ct.release)
+	return ct
+}
+
+// launch cria uma execução com a política informada e a entrega ao serviço
+func (ct *concurrencyTest) launch(policy string, maxActiveRuns int) (*WorkflowExecutor, string) {
+	workflow := &models.WorkflowResponse{
+		Name:          "wf",
+		Concurrency:   policy,
+		MaxActiveRuns: maxActiveRuns,
+		Steps:         []models.Step{{Name: "wait", Run: ct.step}},
+	}
+	executor := NewWorkflowExecutor("wf", workflow, models.TriggerSchedule, nil, ct.ws.config)
+	return executor, ct.ws.launch(executor)
+}
+
+// wait espera a execução chegar a um dos status
+func (ct *concurrencyTest) wait(executor *WorkflowExecutor, statuses ...string) models.Run {
+	ct.t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if run := executor.Snapshot(); slices.Contains(statuses, run.Status) {
+			return run
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ct.t.Fatalf("execução com status %s; esperado um de %v", executor.Snapshot().Status, statuses)
+	return models.Run{}
+}
+
+// idle espera o serviço não ter mais execuções ativas
+func (ct *concurrencyTest) idle() {
+	ct.t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		ct.ws.mu.RLock()
+		active := len(ct.ws.active)
+		ct.ws.mu.RUnlock()
+		if active == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ct.t.Fatalf("execuções ainda ativas")
+}
+
+func TestConcurrencySkip(t *testing.T) {
+	ct := newConcurrencyTest(t)
+
+	first, status := ct.launch(ConcurrencySkip, 0)
+	if status != "running" {
+		t.Fatalf("primeira execução %s; esperado running", status)
+	}
+
+	second, status := ct.launch(ConcurrencySkip, 0)
+	if status != "skipped" {
+		t.Fatalf("segunda execução %s; esperado skipped", status)
+	}
+	if run := second.Snapshot(); run.Status != "skipped" || run.Steps[0].Status != "skipped" {
+		t.Fatalf("execução descartada com status %s / step %s", run.Status, run.Steps[0].Status)
+	}
+
+	ct.release()
+	ct.wait(first, "success")
+	ct.idle()
+}
+
+func TestConcurrencyQueue(t *testing.T) {
+	ct := newConcurrencyTest(t)
+
+	first, _ := ct.launch(ConcurrencyQueue, 0)
+	second, status := ct.launch(ConcurrencyQueue, 0)
+	if status != "queued" {
+		t.Fatalf("segunda execução %s; esperado queued", status)
+	}
+
+	// A execução na fila só começa depois que a primeira termina
+	ct.wait(first, "running")
+	time.Sleep(100 * time.Millisecond)
+	if run := second.Snapshot(); run.Status != "queued" {
+		t.Fatalf("execução na fila com status %s antes da primeira terminar", run.Status)
+	}
+
+	ct.release()
+	done := ct.wait(first, "success")
+	run := ct.wait(second, "success")
+	if run.StartTime.Before(*done.EndTime) {
+		t.Fatalf("execução da fila começou antes da anterior terminar")
+	}
+	ct.idle()
+}
+
+func TestConcurrencyReplace(t *testing.T) {
+	ct := newConcurrencyTest(t)
+
+	first, _ := ct.launch(ConcurrencyReplace, 0)
+	ct.wait(first, "running")
+
+	second, status := ct.launch(ConcurrencyReplace, 0)
+	if status != "queued" {
+		t.Fatalf("segunda execução %s; esperado queued", status)
+	}
+
+	// A execução em andamento é cancelada com a causa da substituição
+	run := ct.wait(first, "cancelled")
+	if run.Steps[0].Status != "cancelled" || run.Steps[0].Error != errRunReplaced.Error() {
+		t.Fatalf("step substituído com status %s: %s", run.Steps[0].Status, run.Steps[0].Error)
+	}
+
+	ct.wait(second, "running")
+	ct.release()
+	ct.wait(second, "success")
+	ct.idle()
+}
+
+func TestConcurrencyMaxActiveRuns(t *testing.T) {
+	ct := newConcurrencyTest(t)
+
+	runs := make([]*WorkflowExecutor, 0, 3)
+	statuses := make([]string, 0, 3)
+	for range 3 {
+		executor, status := ct.launch(ConcurrencyAllow, 2)
+		runs = append(runs, executor)
+		statuses = append(statuses, status)
+	}
+	if !slices.Equal(statuses, []string{"running", "running", "queued"}) {
+		t.Fatalf("status = %v; esperado duas rodando e uma na fila", statuses)
+	}
+
+	ct.release()
+	for _, executor := range runs {
+		ct.wait(executor, "success")
+	}
+	ct.idle()
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// errWorkflowTimeout encerra a execução quando o timeout do workflow expira
+	errWorkflowTimeout = errors.New("timeout do workflow expirado")
+	// errDeadlineMissed encerra a execução quando o horário limite chega
+	errDeadlineMissed = errors.New("horário limite do workflow atingido")
+	// errDeadlineUnreachable encerra a execução antes do horário limite quando
+	// as durações anteriores mostram que ela não terminaria a tempo
+	errDeadlineUnreachable = errors.New("execução não terminaria antes do horário limite")
+)
+
+// parseDeadline interpreta o horário limite no formato HH:MM ou HH:MM:SS
+func parseDeadline(deadline string) (time.Time, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, deadline); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("formato esperado HH:MM ou HH:MM:SS")
+}
+
+// nextDeadline retorna a primeira ocorrência do horário limite depois de
+// start, no fuso local do servidor. Uma execução que começa depois do horário
+// mira o mesmo horário do dia seguinte
+func nextDeadline(start time.Time, deadline string) (time.Time, error) {
+	clock, err := parseDeadline(deadline)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := start.Local()
+	next := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.Local)
+	if !next.After(local) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// lastDurations retorna a duração de cada step na última execução bem-sucedida
+// do workflow, usada para estimar se o horário limite ainda é alcançável
+func lastDurations(workflowID string) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+
+	for _, run := range loadRuns(workflowID) {
+		if run.Status != "success" {
+			continue
+		}
+		for _, step := range run.Steps {
+			durations[step.StepName] = step.Duration
+		}
+		break
+	}
+
+	return durations
+}
+
+// criticalPath estima quanto falta a partir do início de um step: a duração
+// dele somada ao caminho mais longo entre os steps que dependem dele
+func criticalPath(name string, estimates map[string]time.Duration, dependents map[string][]string, memo map[string]time.Duration) time.Duration {
+	if d, exists := memo[name]; exists {
+		return d
+	}
+
+	// Marca antes de descer para não entrar em loop em grafos com ciclo
+	memo[name] = estimates[name]
+
+	longest := time.Duration(0)
+	for _, dependent := range dependents[name] {
+		longest = max(longest, criticalPath(dependent, estimates, dependents, memo))
+	}
+
+	memo[name] = estimates[name] + longest
+	return memo[name]
+}
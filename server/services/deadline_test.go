@@ -0,0 +1,137 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"orchestrium.sh/models"
+)
+
+func TestParseDeadline(t *testing.T) {
+	valid := map[string][3]int{
+		"06:30":    {6, 30, 0},
+		"23:59:59": {23, 59, 59},
+		"00:00":    {0, 0, 0},
+	}
+	for text, expected := range valid {
+		clock, err := parseDeadline(text)
+		if err != nil {
+			t.Fatalf("parseDeadline(%q): %v", text, err)
+		}
+		if got := [3]int{clock.Hour(), clock.Minute(), clock.Second()}; got != expected {
+			t.Errorf("parseDeadline(%q) = %v; esperado %v", text, got, expected)
+		}
+	}
+
+	for _, text := range []string{"", "6h30", "24:00", "12:60", "1230", "12:30 PM"} {
+		if _, err := parseDeadline(text); err == nil {
+			t.Errorf("parseDeadline(%q) aceito", text)
+		}
+	}
+}
+
+func TestNextDeadline(t *testing.T) {
+	at := func(day int, hour int, min int) time.Time {
+		return time.Date(2026, time.March, day, hour, min, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name     string
+		start    time.Time
+		deadline string
+		expected time.Time
+	}{
+		{"mais tarde no mesmo dia", at(10, 1, 0), "06:00", at(10, 6, 0)},
+		{"já passou, vai para amanhã", at(10, 7, 0), "06:00", at(11, 6, 0)},
+		{"exatamente no horário, vai para amanhã", at(10, 6, 0), "06:00", at(11, 6, 0)},
+		{"virada do mês", at(31, 23, 30), "00:15", time.Date(2026, time.April, 1, 0, 15, 0, 0, time.Local)},
+		{"com segundos", at(10, 6, 0), "06:00:30", at(10, 6, 0).Add(30 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := nextDeadline(tt.start, tt.deadline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !next.Equal(tt.expected) {
+				t.Fatalf("nextDeadline(%s, %s) = %s; esperado %s", tt.start, tt.deadline, next, tt.expected)
+			}
+		})
+	}
+
+	if _, err := nextDeadline(time.Now(), "amanhã"); err == nil {
+		t.Fatalf("horário inválido aceito")
+	}
+}
+
+func TestCriticalPath(t *testing.T) {
+	// extract -> quick -> load
+	//         -> slow  -> report -> load
+	estimates := map[string]time.Duration{
+		"extract": 1 * time.Minute,
+		"quick":   1 * time.Minute,
+		"slow":    10 * time.Minute,
+		"report":  5 * time.Minute,
+		"load":    2 * time.Minute,
+	}
+	dependents := map[string][]string{
+		"extract": {"quick", "slow"},
+		"quick":   {"load"},
+		"slow":    {"report"},
+		"report":  {"load"},
+	}
+
+	expected := map[string]time.Duration{
+		"extract": 18 * time.Minute,
+		"quick":   3 * time.Minute,
+		"slow":    17 * time.Minute,
+		"report":  7 * time.Minute,
+		"load":    2 * time.Minute,
+	}
+
+	memo := make(map[string]time.Duration)
+	for name, duration := range expected {
+		if got := criticalPath(name, estimates, dependents, memo); got != duration {
+			t.Errorf("criticalPath(%s) = %s; esperado %s", name, got, duration)
+		}
+	}
+
+	// Steps sem duração conhecida contam como zero
+	if got := criticalPath("new", estimates, map[string][]string{"new": {"load"}}, make(map[string]time.Duration)); got != 2*time.Minute {
+		t.Errorf("criticalPath de step sem estimativa = %s; esperado 2m", got)
+	}
+}
+
+func TestCriticalPathCycle(t *testing.T) {
+	estimates := map[string]time.Duration{"a": time.Minute, "b": time.Minute}
+	dependents := map[string][]string{"a": {"b"}, "b": {"a"}}
+
+	// Só precisa terminar; ciclos são recusados na validação
+	criticalPath("a", estimates, dependents, make(map[string]time.Duration))
+}
+
+func TestLastDurations(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	now := time.Now()
+	runs := []models.Run{
+		{Id: "old", Status: "success", CreatedAt: now.Add(-2 * time.Hour), Steps: []models.ExecutionState{{StepName: "a", Duration: time.Minute}}},
+		{Id: "recent", Status: "success", CreatedAt: now.Add(-time.Hour), Steps: []models.ExecutionState{{StepName: "a", Duration: 3 * time.Minute}}},
+		{Id: "failed", Status: "failed", CreatedAt: now, Steps: []models.ExecutionState{{StepName: "a", Duration: time.Second}}},
+	}
+	for i := range runs {
+		runs[i].WorkflowId = "wf"
+		if err := saveRun(&runs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Vale a última execução bem-sucedida
+	if got := lastDurations("wf")["a"]; got != 3*time.Minute {
+		t.Fatalf("lastDurations = %s; esperado 3m", got)
+	}
+	if got := lastDurations("missing"); len(got) != 0 {
+		t.Fatalf("lastDurations sem execuções = %v", got)
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"orchestrium.sh/models"
+)
+
+var unsafeEnvChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// serverEnv retorna o ambiente do processo sem as variáveis ORCHESTRIUM_*,
+// que guardam a chave mestra, o token dos agentes e a configuração do
+// servidor e não podem chegar aos steps nem aos builds de dependências
+func serverEnv() []string {
+	env := make([]string, 0)
+	for _, entry := range os.Environ() {
+		if !strings.HasPrefix(entry, "ORCHESTRIUM_") {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+// stepEnv monta o ambiente do processo do step: o ambiente do servidor
+// filtrado por serverEnv, os caminhos do workspace e do arquivo de outputs, o
+// virtualenv, se houver, e as variáveis da execução montadas por runEnv
+func (we *WorkflowExecutor) stepEnv(step *models.Step, outputFile string) []string {
+	env := serverEnv()
+	env = append(env,
+		"ORCHESTRIUM_OUTPUT="+outputFile,
+		"ORCHESTRIUM_WORKSPACE="+we.workspace,
+	)
+
+	// Com virtualenv, python e pip chamados pelo PATH também são os do ambiente
+	if we.venv != "" {
+		env = append(env,
+			"VIRTUAL_ENV="+we.venv,
+			"PATH="+filepath.Join(we.venv, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"),
+		)
+	}
+
+	return append(env, we.runEnv(step)...)
+}
+
+// runEnv monta as variáveis da execução, que não dependem da máquina onde o
+// step roda e por isso também seguem para os agentes remotos: as
+// ORCHESTRIUM_* da execução, os secrets com o próprio nome, os params como
+// ORCHESTRIUM_PARAM_<NOME> e os outputs dos steps dos quais ele depende,
+// direta ou indiretamente, como ORCHESTRIUM_OUTPUT_<STEP>_<CHAVE>
+func (we *WorkflowExecutor) runEnv(step *models.Step) []string {
+	env := []string{
+		"ORCHESTRIUM_WORKFLOW_ID=" + we.workflowID,
+		"ORCHESTRIUM_RUN_ID=" + we.runID,
+		"ORCHESTRIUM_STEP=" + step.Name,
+	}
+
+	for name, value := range we.secrets {
+		env = append(env, name+"="+value)
+	}
+
+	for name, value := range we.params {
+		env = append(env, "ORCHESTRIUM_PARAM_"+envName(name)+"="+value)
+	}
+
+	we.mu.RLock()
+	defer we.mu.RUnlock()
+
+	for _, upstream := range we.ancestors(step) {
+		state, exists := we.state[upstream]
+		if !exists {
+			continue
+		}
+		for key, value := range state.Outputs {
+			env = append(env, "ORCHESTRIUM_OUTPUT_"+envName(upstream)+"_"+envName(key)+"="+value)
+		}
+	}
+
+	return env
+}
+
+// ancestors retorna todos os steps dos quais o step depende, direta ou indiretamente
+func (we *WorkflowExecutor) ancestors(step *models.Step) []string {
+	index := make(map[string]*models.Step, len(we.steps))
+	for i := range we.steps {
+		index[we.steps[i].Name] = &we.steps[i]
+	}
+
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+
+	var visit func(s *models.Step)
+	visit = func(s *models.Step) {
+		for _, dep := range s.Depends {
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			result = append(result, dep)
+			if upstream, exists := index[dep]; exists {
+				visit(upstream)
+			}
+		}
+	}
+	visit(step)
+
+	return result
+}
@@ -2,145 +2,448 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
+	"orchestrium.sh/config"
 	"orchestrium.sh/models"
 )
 
-type ExecutionState struct {
-	StepName   string
-	Status     string // "pending", "running", "success", "failed"
-	Output     string
-	Error      string
-	StartTime  time.Time
-	EndTime    time.Time
-	Duration   time.Duration
-}
+// defaultGracePeriod é o tempo entre o SIGTERM e o SIGKILL quando o step
+// não define grace_period
+const defaultGracePeriod = 10 * time.Second
+
+// outputWaitDelay limita quanto tempo esperamos pelos pipes de saída depois
+// que o processo termina, caso algum subprocesso ainda os mantenha abertos
+const outputWaitDelay = 5 * time.Second
+
+var (
+	// errStepTimeout indica que a tentativa foi interrompida pelo timeout do step
+	errStepTimeout = errors.New("execução expirada (timeout)")
+	// errRunCancelled é a causa usada ao cancelar uma execução em andamento
+	errRunCancelled = errors.New("execução cancelada")
+)
+
+// defaultParallelism é o número máximo de steps simultâneos quando o
+// workflow não define parallelism
+const defaultParallelism = 4
 
 type WorkflowExecutor struct {
-	workflowID string
-	steps      []models.Step
-	state      map[string]*ExecutionState
-	mu         sync.RWMutex
+	config      *config.Config
+	workflowID  string
+	runID       string
+	trigger     string
+	params      map[string]string
+	secrets     map[string]string
+	secretMask  *strings.Replacer
+	steps       []models.Step
+	parallelism int
+
+	// concurrency e maxActiveRuns controlam a sobreposição com outras
+	// execuções do mesmo workflow
+	concurrency   string
+	maxActiveRuns int
+
+	// timeout e deadline limitam a duração da execução inteira
+	timeout  time.Duration
+	deadline string
+
+	// workspace é o diretório de trabalho da execução, removido ao final
+	// conforme workspaceCleanup
+	workspace        string
+	workspaceCleanup string
+
+	// limits vale para todos os steps, exceto nos campos que o step redefine
+	limits *models.Limits
+
+	// sandbox define o usuário e o isolamento dos processos dos steps
+	sandbox *models.Sandbox
+
+	// environment é o virtualenv criado a partir das dependências de src/ e
+	// venv o diretório dele, vazio quando os steps usam o python do sistema
+	environment *models.Environment
+	venv        string
+
+	// pool é a fila global de steps e pools os pools nomeados da
+	// configuração; slots conta as vagas globais em uso por esta execução e
+	// started indica se algum step dela já começou a rodar
+	pool    *workerPool
+	pools   map[string]*workerPool
+	slots   int
+	started bool
+
+	// agents recebe os steps com runs_on, executados em agentes remotos
+	agents *agentHub
+
+	// priority ordena os steps na fila global. priorityOverride guarda a
+	// prioridade informada no disparo manual, que substitui as do conf.yaml
+	priority         int
+	priorityOverride *int
+
+	state     map[string]*models.ExecutionState
+	status    string
+	err       string
+	createdAt time.Time
+	startTime time.Time
+	endTime   time.Time
+	mu        sync.RWMutex
+	persistMu sync.Mutex
 }
 
-func NewWorkflowExecutor(workflowID string, steps []models.Step) *WorkflowExecutor {
-	state := make(map[string]*ExecutionState)
-	for _, step := range steps {
-		state[step.Name] = &ExecutionState{
+func NewWorkflowExecutor(workflowID string, workflow *models.WorkflowResponse, trigger string, params map[string]string, cfg *config.Config) *WorkflowExecutor {
+	state := make(map[string]*models.ExecutionState)
+	for _, step := range workflow.Steps {
+		state[step.Name] = &models.ExecutionState{
 			StepName: step.Name,
 			Status:   "pending",
 		}
 	}
 
+	parallelism := workflow.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultParallelism
+	}
+
+	concurrency, maxActiveRuns := concurrencyDefaults(workflow)
+
+	workspaceCleanup := workflow.WorkspaceCleanup
+	if workspaceCleanup == "" {
+		workspaceCleanup = cfg.WorkspaceCleanup
+	}
+
 	return &WorkflowExecutor{
-		workflowID: workflowID,
-		steps:      steps,
-		state:      state,
+		config:           cfg,
+		workflowID:       workflowID,
+		runID:            uuid.New().String(),
+		trigger:          trigger,
+		params:           params,
+		steps:            workflow.Steps,
+		parallelism:      parallelism,
+		concurrency:      concurrency,
+		maxActiveRuns:    maxActiveRuns,
+		timeout:          time.Duration(workflow.Timeout) * time.Second,
+		deadline:         workflow.Deadline,
+		workspaceCleanup: workspaceCleanup,
+		limits:           workflow.Limits,
+		sandbox:          workflow.Sandbox,
+		priority:         workflow.Priority,
+		state:            state,
+		status:           "pending",
+		createdAt:        time.Now(),
 	}
 }
 
-// Execute executa o workflow respeitando as dependências
+// Execute executa o workflow como um DAG: cada step inicia assim que suas
+// dependências terminam, com no máximo parallelism steps rodando ao mesmo tempo
 func (we *WorkflowExecutor) Execute(ctx context.Context, srcPath string) error {
-	fmt.Printf("[WORKFLOW %s] Iniciando execução\n", we.workflowID)
+	fmt.Printf("[WORKFLOW %s] Iniciando execução %s\n", we.workflowID, we.runID)
+
+	we.mu.Lock()
+	we.status = "running"
+	we.startTime = time.Now()
+	we.mu.Unlock()
+	we.persist()
+
+	if err := we.prepareWorkspace(srcPath); err != nil {
+		we.finishPending("failed", fmt.Sprintf("Step não iniciado: %v", err))
+		we.finish(err)
+		fmt.Printf("[WORKFLOW %s] %v\n", we.workflowID, err)
+		return err
+	}
+	defer we.cleanupWorkspace()
+	defer we.pruneArtifacts()
+
+	// Timeout e horário limite do workflow cancelam todos os steps restantes
+	ctx, cancelRun := context.WithCancelCause(ctx)
+	defer cancelRun(nil)
+
+	if we.timeout > 0 {
+		timer := time.AfterFunc(we.timeout, func() { cancelRun(errWorkflowTimeout) })
+		defer timer.Stop()
+	}
+
+	var deadline time.Time
+	var estimates map[string]time.Duration
+	if we.deadline != "" {
+		var err error
+		if deadline, err = nextDeadline(we.startTime, we.deadline); err != nil {
+			cancelRun(fmt.Errorf("horário limite inválido: %w", err))
+		} else {
+			timer := time.AfterFunc(time.Until(deadline), func() { cancelRun(errDeadlineMissed) })
+			defer timer.Stop()
+			estimates = lastDurations(we.workflowID)
+		}
+	}
+
+	// A criação do virtualenv conta no tempo do workflow
+	if err := we.prepareEnvironment(ctx); err != nil {
+		status := "failed"
+		if ctx.Err() != nil {
+			status, err = "cancelled", context.Cause(ctx)
+		}
+		we.finishPending(status, fmt.Sprintf("Step não iniciado: %v", err))
+		we.finish(err)
+		fmt.Printf("[WORKFLOW %s] %v\n", we.workflowID, err)
+		return err
+	}
 
 	// Criar mapa de steps por nome para acesso rápido
 	stepMap := make(map[string]*models.Step)
+	order := make([]string, 0, len(we.steps))
 	for i := range we.steps {
+		if _, exists := stepMap[we.steps[i].Name]; !exists {
+			order = append(order, we.steps[i].Name)
+		}
 		stepMap[we.steps[i].Name] = &we.steps[i]
 	}
 
-	// Executar steps respeitando dependências
-	for _, step := range we.steps {
-		select {
-		case <-ctx.Done():
-			fmt.Printf("[WORKFLOW %s] Execução cancelada\n", we.workflowID)
-			return ctx.Err()
-		default:
+	// Contar dependências pendentes e quem depende de cada step
+	pending := make(map[string]int)
+	dependents := make(map[string][]string)
+	for _, name := range order {
+		for _, dep := range stepMap[name].Depends {
+			if _, exists := stepMap[dep]; exists {
+				pending[name]++
+				dependents[dep] = append(dependents[dep], name)
+			}
 		}
+	}
+
+	memo := make(map[string]time.Duration)
 
-		// Aguardar dependências
-		if err := we.awaitDependencies(step.Depends); err != nil {
-			we.mu.Lock()
-			we.state[step.Name].Status = "failed"
-			we.state[step.Name].Error = fmt.Sprintf("Dependência falhou: %v", err)
-			we.mu.Unlock()
-			fmt.Printf("[WORKFLOW %s] Step %s falhou (dependência): %v\n", we.workflowID, step.Name, err)
-			continue
+	ready := make([]string, 0, len(order))
+	for _, name := range order {
+		if pending[name] == 0 {
+			ready = append(ready, name)
 		}
+	}
 
-		// Executar step
-		if err := we.executeStep(&step, srcPath); err != nil {
-			fmt.Printf("[WORKFLOW %s] Step %s falhou: %v\n", we.workflowID, step.Name, err)
+	// release libera os dependentes de um step que terminou
+	release := func(name string) {
+		for _, dependent := range dependents[name] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
 		}
 	}
 
+	done := make(chan string)
+	ctxDone := ctx.Done()
+	running, finished := 0, 0
+
+	for finished < len(order) {
+		// Despachar os steps prontos enquanto houver vaga
+		for len(ready) > 0 && running < we.parallelism && ctx.Err() == nil {
+			name := ready[0]
+			step := stepMap[name]
+
+			// Com horário limite, não inicia um step que pela última execução
+			// bem-sucedida já não terminaria a tempo
+			if !deadline.IsZero() && time.Now().Add(criticalPath(name, estimates, dependents, memo)).After(deadline) {
+				fmt.Printf("[WORKFLOW %s] Step %s não terminaria antes de %s\n", we.workflowID, name, deadline.Format("15:04:05"))
+				cancelRun(errDeadlineUnreachable)
+				break
+			}
+			ready = ready[1:]
+
+			if run, status, reason := evaluateTriggerRule(step.TriggerRule, we.upstreamStatuses(step.Depends)); !run {
+				we.finishState(name, status, reason)
+				we.persist()
+				fmt.Printf("[WORKFLOW %s] Step %s não executado (%s): %s\n", we.workflowID, name, status, reason)
+				finished++
+				release(name)
+				continue
+			}
+
+			running++
+			go func(step *models.Step) {
+				defer func() { done <- step.Name }()
+
+				releaseSlot, err := we.acquireSlot(ctx, step)
+				if err != nil {
+					// Só a interrupção da execução conta como cancelamento
+					status := "failed"
+					if ctx.Err() != nil {
+						status = "cancelled"
+					}
+					we.finishState(step.Name, status, fmt.Sprintf("Step não iniciado: %v", err))
+					we.persist()
+					return
+				}
+				defer releaseSlot()
+
+				if err := we.executeStep(ctx, step, we.workspace); err != nil {
+					fmt.Printf("[WORKFLOW %s] Step %s falhou: %v\n", we.workflowID, step.Name, err)
+				}
+			}(step)
+		}
+
+		if running == 0 {
+			// Nada rodando e nada pronto: cancelado ou dependência circular
+			break
+		}
+
+		select {
+		case name := <-done:
+			running--
+			finished++
+			release(name)
+		case <-ctxDone:
+			// Para de despachar e aguarda os steps em andamento
+			ctxDone = nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		cause := context.Cause(ctx)
+		we.finishPending("cancelled", fmt.Sprintf("Step não iniciado: %v", cause))
+		we.finish(cause)
+		fmt.Printf("[WORKFLOW %s] Execução interrompida: %v\n", we.workflowID, cause)
+		return cause
+	}
+
+	if finished < len(order) {
+		we.finishPending("failed", "Dependência circular")
+		fmt.Printf("[WORKFLOW %s] Dependência circular entre steps\n", we.workflowID)
+	}
+
+	we.finish(nil)
 	fmt.Printf("[WORKFLOW %s] Execução concluída\n", we.workflowID)
 	return nil
 }
 
-// awaitDependencies aguarda que todas as dependências sejam concluídas com sucesso
-func (we *WorkflowExecutor) awaitDependencies(depends []string) error {
-	if len(depends) == 0 {
-		return nil
+// finish calcula o status final da execução e grava o histórico. Quando a
+// execução foi interrompida, a causa decide: cancelamento pelo usuário fica
+// "cancelled" e os limites de tempo do workflow ficam "failed". Sem causa, o
+// status vem dos steps
+func (we *WorkflowExecutor) finish(cause error) {
+	we.mu.Lock()
+	switch {
+	case errors.Is(cause, errRunCancelled) || errors.Is(cause, errRunReplaced):
+		we.status = "cancelled"
+		we.err = cause.Error()
+	case cause != nil:
+		we.status = "failed"
+		we.err = cause.Error()
+	default:
+		// Steps pulados pela regra de disparo não fazem a execução falhar
+		we.status = "success"
+		for _, state := range we.state {
+			if state.Status == "cancelled" {
+				we.status = "cancelled"
+				break
+			}
+			if state.Status != "success" && state.Status != "skipped" {
+				we.status = "failed"
+			}
+		}
 	}
+	we.endTime = time.Now()
+	we.mu.Unlock()
 
-	// Aguardar com timeout de 30 segundos (pode ser configurável)
-	timeout := time.After(30 * time.Second)
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
+	we.persist()
+}
 
-	for {
-		select {
-		case <-timeout:
-			return fmt.Errorf("timeout aguardando dependências")
-		case <-ticker.C:
-			we.mu.RLock()
-			allDone := true
-			var failedDeps []string
-
-			for _, dep := range depends {
-				if state, exists := we.state[dep]; exists {
-					if state.Status == "pending" || state.Status == "running" {
-						allDone = false
-						break
-					}
-					if state.Status == "failed" {
-						failedDeps = append(failedDeps, dep)
-					}
-				} else {
-					// Dependência não existe
-					failedDeps = append(failedDeps, dep)
-				}
-			}
-			we.mu.RUnlock()
+// markQueued registra que a execução aguarda uma vaga para iniciar
+func (we *WorkflowExecutor) markQueued() {
+	we.mu.Lock()
+	we.status = "queued"
+	we.mu.Unlock()
 
-			if allDone {
-				if len(failedDeps) > 0 {
-					return fmt.Errorf("dependências falharam: %v", failedDeps)
-				}
-				return nil
-			}
+	we.persist()
+}
+
+// abort encerra uma execução que não chegou a rodar, com todos os steps no
+// mesmo status, e grava o histórico
+func (we *WorkflowExecutor) abort(status string, message string) {
+	we.finishPending(status, message)
+
+	we.mu.Lock()
+	we.status = status
+	if we.startTime.IsZero() {
+		we.startTime = time.Now()
+	}
+	we.endTime = time.Now()
+	we.mu.Unlock()
+
+	we.persist()
+}
+
+// upstreamStatuses retorna o status final de cada dependência. Dependências
+// inexistentes aparecem como "failed"
+func (we *WorkflowExecutor) upstreamStatuses(depends []string) map[string]string {
+	we.mu.RLock()
+	defer we.mu.RUnlock()
+
+	statuses := make(map[string]string, len(depends))
+	for _, dep := range depends {
+		if state, exists := we.state[dep]; exists {
+			statuses[dep] = state.Status
+		} else {
+			statuses[dep] = "failed"
+		}
+	}
+	return statuses
+}
+
+// finishState encerra um step que não chegou a executar
+func (we *WorkflowExecutor) finishState(stepName string, status string, message string) {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+
+	now := time.Now()
+	we.state[stepName].Status = status
+	we.state[stepName].Error = message
+	we.state[stepName].StartTime = now
+	we.state[stepName].EndTime = now
+}
+
+// finishPending encerra com o status informado os steps que nunca foram despachados
+func (we *WorkflowExecutor) finishPending(status string, message string) {
+	we.mu.RLock()
+	var names []string
+	for name, state := range we.state {
+		if state.Status == "pending" {
+			names = append(names, name)
 		}
 	}
+	we.mu.RUnlock()
+
+	for _, name := range names {
+		we.finishState(name, status, message)
+	}
 }
 
-// executeStep executa um step individual
-func (we *WorkflowExecutor) executeStep(step *models.Step, srcPath string) error {
+// executeStep executa um step individual, script ou comando inline,
+// repetindo conforme Attempts e Retry.
+// A saída é gravada em runs/<run-id>/<step>.log dentro do workflow
+func (we *WorkflowExecutor) executeStep(ctx context.Context, step *models.Step, workDir string) error {
 	we.mu.Lock()
 	we.state[step.Name].Status = "running"
 	we.state[step.Name].StartTime = time.Now()
+	we.started = true
 	we.mu.Unlock()
+	we.persist()
+	defer we.persist()
 
-	scriptPath := filepath.Join(srcPath, step.Script)
+	// Steps com run não têm arquivo; o comando roda direto no workspace da execução
+	scriptPath := ""
+	if step.Run == "" {
+		scriptPath = filepath.Join(workDir, step.Script)
+	}
 
 	// Verificar se arquivo existe
-	if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
+	if _, err := os.Stat(scriptPath); scriptPath != "" && os.IsNotExist(err) {
 		we.mu.Lock()
 		we.state[step.Name].Status = "failed"
 		we.state[step.Name].Error = fmt.Sprintf("Script não encontrado: %s", scriptPath)
@@ -150,32 +453,102 @@ func (we *WorkflowExecutor) executeStep(step *models.Step, srcPath string) error
 		return fmt.Errorf("script não encontrado: %s", step.Script)
 	}
 
-	// Preparar comando
-	cmd := exec.Command("python3", scriptPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	// Executar com timeout se configurado
-	var timeout time.Duration
-	if step.Timeout > 0 {
-		timeout = time.Duration(step.Timeout) * time.Second
-	} else {
-		timeout = 5 * time.Minute // timeout padrão
+	logPath := filepath.Join(runDir(we.workflowID, we.runID), logFileName(step.Name))
+	stepLog, err := openStepLog(logPath)
+	if err != nil {
+		we.mu.Lock()
+		we.state[step.Name].Status = "failed"
+		we.state[step.Name].Error = fmt.Sprintf("Erro ao criar log: %v", err)
+		we.state[step.Name].EndTime = time.Now()
+		we.state[step.Name].Duration = we.state[step.Name].EndTime.Sub(we.state[step.Name].StartTime)
+		we.mu.Unlock()
+		return fmt.Errorf("erro ao criar log: %w", err)
+	}
+	defer stepLog.Close()
+	stepLog.mask = we.secretMask
+
+	// O caminho precisa ser absoluto porque o processo pode rodar em outro diretório
+	outputFile, _ := filepath.Abs(filepath.Join(runDir(we.workflowID, we.runID), "outputs", safeFileName(step.Name)+".env"))
+
+	sr := &stepRun{
+		step:       step,
+		workDir:    workDir,
+		scriptPath: scriptPath,
+		log:        stepLog,
+		stdout:     stepLog.Stream(StreamStdout),
+		stderr:     stepLog.Stream(StreamStderr),
+		outputFile: outputFile,
 	}
+	sr.stdout.onLine = sr.collectOutput
+	attempts := maxAttempts(step)
 
-	// Criar contexto com timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	for attempt := 1; ; attempt++ {
+		stepLog.System("tentativa %d/%d iniciada", attempt, attempts)
 
-	// Executar comando
-	err := we.executeWithTimeout(ctx, cmd)
+		var attemptState models.AttemptState
+		attemptState, err = we.runAttempt(ctx, sr, attempt)
+
+		if attemptState.Signal != "" {
+			stepLog.System("processo encerrado com %s", attemptState.Signal)
+		}
+
+		if err != nil {
+			stepLog.System("tentativa %d/%d falhou: %v", attempt, attempts, err)
+		} else {
+			stepLog.System("tentativa %d/%d concluída", attempt, attempts)
+		}
+
+		we.mu.Lock()
+		we.state[step.Name].Attempts = append(we.state[step.Name].Attempts, attemptState)
+		we.state[step.Name].Signal = attemptState.Signal
+		we.state[step.Name].LimitExceeded = attemptState.LimitExceeded
+		we.state[step.Name].Output = sr.stdout.Tail()
+		we.state[step.Name].Stderr = sr.stderr.Tail()
+		we.state[step.Name].Outputs = sr.outputs
+		we.mu.Unlock()
+		we.persist()
+
+		if err == nil || ctx.Err() != nil || attempt >= attempts || !shouldRetry(step.Retry, attemptState.ExitCode, attemptState.TimedOut) {
+			break
+		}
+
+		delay := retryDelay(step.Retry, attempt)
+		fmt.Printf("[WORKFLOW %s] [STEP %s] Tentativa %d/%d falhou: %v (nova tentativa em %s)\n", we.workflowID, step.Name, attempt, attempts, err, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			err = errRunCancelled
+			stepLog.System("execução cancelada durante a espera entre tentativas")
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// Artifacts são coletados mesmo em falhas, quando costumam ser mais úteis
+	var artifacts []models.Artifact
+	if len(step.Artifacts) > 0 {
+		artifacts = we.collectArtifacts(step, workDir, stepLog)
+	}
 
 	we.mu.Lock()
 	defer we.mu.Unlock()
 
+	we.state[step.Name].Artifacts = artifacts
+
 	we.state[step.Name].EndTime = time.Now()
 	we.state[step.Name].Duration = we.state[step.Name].EndTime.Sub(we.state[step.Name].StartTime)
 
+	if err != nil && ctx.Err() != nil {
+		we.state[step.Name].Status = "cancelled"
+		we.state[step.Name].Error = context.Cause(ctx).Error()
+		fmt.Printf("[WORKFLOW %s] [STEP %s] Cancelado\n", we.workflowID, step.Name)
+		return err
+	}
+
 	if err != nil {
 		we.state[step.Name].Status = "failed"
 		we.state[step.Name].Error = err.Error()
@@ -184,37 +557,264 @@ func (we *WorkflowExecutor) executeStep(step *models.Step, srcPath string) error
 	}
 
 	we.state[step.Name].Status = "success"
+	we.state[step.Name].Error = ""
 	fmt.Printf("[WORKFLOW %s] [STEP %s] Concluído com sucesso (%.2fs)\n", we.workflowID, step.Name, we.state[step.Name].Duration.Seconds())
 	return nil
 }
 
-// executeWithTimeout executa um comando com timeout
-func (we *WorkflowExecutor) executeWithTimeout(ctx context.Context, cmd *exec.Cmd) error {
+// stepRun reúne o que as tentativas de um step compartilham
+type stepRun struct {
+	step       *models.Step
+	workDir    string
+	scriptPath string
+	log        *stepLog
+	stdout     *streamWriter
+	stderr     *streamWriter
+	outputFile string
+	outputs    map[string]string
+}
+
+// runAttempt executa o script uma vez, respeitando o timeout do step e o
+// cancelamento da execução
+func (we *WorkflowExecutor) runAttempt(ctx context.Context, sr *stepRun, attempt int) (models.AttemptState, error) {
+	step := sr.step
+	state := models.AttemptState{
+		Number:    attempt,
+		StartTime: time.Now(),
+	}
+
+	// Cada tentativa começa sem outputs nem saída; só valem os da última
+	sr.stdout.Reset()
+	sr.stderr.Reset()
+	err := sr.resetOutputs()
+
+	// Steps com runs_on rodam em um agente remoto
+	if err == nil && len(step.RunsOn) > 0 {
+		return we.remoteAttempt(ctx, sr, state)
+	}
+
+	// Preparar comando conforme o runtime do step
+	var command []string
+	if err == nil {
+		command, err = resolveCommand(we.config, step, sr.scriptPath)
+	}
+	if err == nil {
+		command = we.venvCommand(command)
+	}
+	var cmd *exec.Cmd
+	if err == nil {
+		cmd, err = we.sandboxCommand(command, []string{sr.workDir, sr.outputFile})
+	}
+	if err != nil {
+		return failAttempt(state, err)
+	}
+
+	cmd.Dir = sr.workDir
+	cmd.Env = we.stepEnv(step, sr.outputFile)
+
+	name := fmt.Sprintf("%s-%s-%d", we.runID, safeFileName(step.Name), attempt)
+	state, err = runProcess(ctx, we.config, step, we.stepLimits(step), name, cmd, sr.stdout, sr.stderr, state)
+	sr.readOutputFile()
+
+	return state, err
+}
+
+// failAttempt encerra como falha uma tentativa que não chegou a iniciar o processo
+func failAttempt(state models.AttemptState, err error) (models.AttemptState, error) {
+	state.Status = "failed"
+	state.Error = err.Error()
+	state.ExitCode = -1
+	state.EndTime = time.Now()
+	state.Duration = state.EndTime.Sub(state.StartTime)
+	return state, err
+}
+
+// runProcess executa cmd como uma tentativa do step, com os limites de
+// recursos, o timeout e o grace period do step, e completa state com o
+// resultado. É o mesmo caminho para o executor e para os agentes remotos;
+// cmd já deve ter diretório e ambiente definidos
+func runProcess(ctx context.Context, cfg *config.Config, step *models.Step, limits models.Limits, name string, cmd *exec.Cmd, stdout *streamWriter, stderr *streamWriter, state models.AttemptState) (models.AttemptState, error) {
+	scope, err := newLimitScope(cfg, limits, name)
+	if err != nil {
+		return failAttempt(state, err)
+	}
+	defer scope.close()
+
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = outputWaitDelay
+	setProcessGroup(cmd)
+	if err := scope.prepare(cmd); err != nil {
+		return failAttempt(state, err)
+	}
+
+	gracePeriod := defaultGracePeriod
+	if step.GracePeriod > 0 {
+		gracePeriod = time.Duration(step.GracePeriod) * time.Second
+	}
+
+	// Executar com timeout se configurado
+	var timeout time.Duration
+	if step.Timeout > 0 {
+		timeout = time.Duration(step.Timeout) * time.Second
+	} else {
+		timeout = 5 * time.Minute // timeout padrão
+	}
+
+	// Criar contexto com timeout derivado da execução
+	stepCtx, cancel := context.WithTimeoutCause(ctx, timeout, errStepTimeout)
+	defer cancel()
+
+	// Executar comando
+	signal, err := executeWithTimeout(stepCtx, cmd, gracePeriod)
+	stdout.Flush()
+	stderr.Flush()
+	state.Signal = signal
+
+	if err != nil && stepCtx.Err() == nil {
+		if reason := scope.exceeded(signal, stderr.Tail()); reason != "" {
+			state.LimitExceeded = reason
+			err = fmt.Errorf("%s: %w", limitMessage(reason, limits), err)
+		}
+	}
+
+	state.EndTime = time.Now()
+	state.Duration = state.EndTime.Sub(state.StartTime)
+	state.Status = "success"
+
+	if err != nil {
+		state.Status = "failed"
+		state.Error = err.Error()
+		state.TimedOut = errors.Is(err, errStepTimeout)
+		if !state.TimedOut && ctx.Err() != nil {
+			state.Status = "cancelled"
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			state.ExitCode = exitErr.ExitCode()
+		} else {
+			state.ExitCode = -1
+		}
+	}
+
+	return state, err
+}
+
+// executeWithTimeout executa um comando até terminar ou até o contexto ser
+// encerrado, por timeout ou cancelamento. Nesse caso o grupo do processo
+// recebe SIGTERM e, se não terminar dentro de gracePeriod, SIGKILL; a função
+// retorna a causa do contexto e o último sinal enviado. Também aguarda o fim
+// da cópia da saída para não perder linhas do log
+func executeWithTimeout(ctx context.Context, cmd *exec.Cmd, gracePeriod time.Duration) (string, error) {
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
 	done := make(chan error, 1)
 
 	go func() {
-		done <- cmd.Run()
+		done <- cmd.Wait()
 	}()
 
 	select {
 	case <-ctx.Done():
-		// Timeout
-		if cmd.Process != nil {
-			cmd.Process.Kill()
-		}
-		return fmt.Errorf("execução expirada (timeout)")
 	case err := <-done:
-		return err
+		return exitSignal(err), err
+	}
+
+	signal := terminateProcessGroup(cmd)
+
+	grace := time.NewTimer(gracePeriod)
+	defer grace.Stop()
+
+	select {
+	case <-done:
+	case <-grace.C:
+		signal = killProcessGroup(cmd)
+		<-done
 	}
+
+	return signal, context.Cause(ctx)
+}
+
+// Snapshot monta o registro da execução com o estado atual dos steps
+func (we *WorkflowExecutor) Snapshot() models.Run {
+	we.mu.RLock()
+	defer we.mu.RUnlock()
+
+	run := models.Run{
+		Id:          we.runID,
+		WorkflowId:  we.workflowID,
+		Trigger:     we.trigger,
+		Params:      we.params,
+		Priority:    we.priority,
+		Workspace:   we.workspace,
+		Environment: we.environment,
+		Status:      we.status,
+		Error:       we.err,
+		CreatedAt:   we.createdAt,
+		StartTime:   we.startTime,
+		Steps:       make([]models.ExecutionState, 0, len(we.state)),
+	}
+
+	if !we.endTime.IsZero() {
+		endTime := we.endTime
+		run.EndTime = &endTime
+		run.Duration = endTime.Sub(we.startTime)
+	}
+
+	seen := make(map[string]bool)
+	for _, step := range we.steps {
+		if state, exists := we.state[step.Name]; exists && !seen[step.Name] {
+			seen[step.Name] = true
+			stepState := *state
+			stepState.Attempts = append([]models.AttemptState{}, state.Attempts...)
+			run.Steps = append(run.Steps, stepState)
+		}
+	}
+
+	return run
+}
+
+// persist grava o estado atual em runs/<run-id>/run.json
+func (we *WorkflowExecutor) persist() {
+	we.persistMu.Lock()
+	defer we.persistMu.Unlock()
+
+	run := we.Snapshot()
+	if err := saveRun(&run); err != nil {
+		fmt.Printf("[WORKFLOW %s] Erro ao salvar histórico da execução %s: %v\n", we.workflowID, we.runID, err)
+	}
+}
+
+// setSecrets define os secrets injetados nos steps e a máscara aplicada aos logs
+func (we *WorkflowExecutor) setSecrets(secrets map[string]string) {
+	we.secrets = secrets
+
+	// A chave mestra e o token dos agentes não chegam aos steps, mas são
+	// mascarados também caso algum step os obtenha por outro caminho
+	masked := maps.Clone(secrets)
+	if masked == nil {
+		masked = make(map[string]string)
+	}
+	masked["ORCHESTRIUM_MASTER_KEY"] = we.config.MasterKey
+	masked["ORCHESTRIUM_AGENT_TOKEN"] = we.config.AgentToken
+	we.secretMask = newSecretMasker(masked)
+}
+
+// RunID retorna o identificador desta execução
+func (we *WorkflowExecutor) RunID() string {
+	return we.runID
 }
 
 // GetState retorna o estado atual da execução
-func (we *WorkflowExecutor) GetState() map[string]*ExecutionState {
+func (we *WorkflowExecutor) GetState() map[string]*models.ExecutionState {
 	we.mu.RLock()
 	defer we.mu.RUnlock()
 
 	// Fazer cópia para evitar race conditions
-	stateCopy := make(map[string]*ExecutionState)
+	stateCopy := make(map[string]*models.ExecutionState)
 	for k, v := range we.state {
 		stateCopy[k] = v
 	}
@@ -222,7 +822,7 @@ func (we *WorkflowExecutor) GetState() map[string]*ExecutionState {
 }
 
 // GetStepState retorna o estado de um step específico
-func (we *WorkflowExecutor) GetStepState(stepName string) *ExecutionState {
+func (we *WorkflowExecutor) GetStepState(stepName string) *models.ExecutionState {
 	we.mu.RLock()
 	defer we.mu.RUnlock()
 
@@ -230,4 +830,4 @@ func (we *WorkflowExecutor) GetStepState(stepName string) *ExecutionState {
 		return state
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orchestrium.sh/config"
+	"orchestrium.sh/models"
+)
+
+// runWorkflow executa os steps em um diretório temporário, como o servidor
+// faz a partir de workflows/<id>/src, e retorna o estado final de cada step
+func runWorkflow(t *testing.T, parallelism int, steps []models.Step) map[string]*models.ExecutionState {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	src := filepath.Join("workflows", "wf", "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	workflow := &models.WorkflowResponse{Name: "wf", Parallelism: parallelism, Steps: steps}
+	executor := NewWorkflowExecutor("wf", workflow, models.TriggerManual, nil, config.Default())
+	executor.Execute(context.Background(), src)
+
+	return executor.GetState()
+}
+
+func TestExecuteDependencyOrder(t *testing.T) {
+	state := runWorkflow(t, 0, []models.Step{
+		{Name: "join", Run: "true", Depends: []string{"left", "right"}},
+		{Name: "left", Run: "sleep 0.2", Depends: []string{"start"}},
+		{Name: "right", Run: "sleep 0.2", Depends: []string{"start"}},
+		{Name: "start", Run: "true"},
+	})
+
+	for name, step := range state {
+		if step.Status != "success" {
+			t.Fatalf("step %s terminou com %s: %s", name, step.Status, step.Error)
+		}
+	}
+
+	// Cada step só começa depois das dependências
+	for _, edge := range [][2]string{{"start", "left"}, {"start", "right"}, {"left", "join"}, {"right", "join"}} {
+		dep, step := state[edge[0]], state[edge[1]]
+		if step.StartTime.Before(dep.EndTime) {
+			t.Errorf("%s começou antes de %s terminar", edge[1], edge[0])
+		}
+	}
+
+	// Os ramos independentes rodam ao mesmo tempo
+	left, right := state["left"], state["right"]
+	if !left.StartTime.Before(right.EndTime) || !right.StartTime.Before(left.EndTime) {
+		t.Errorf("left e right não rodaram em paralelo")
+	}
+}
+
+func TestExecuteParallelismLimit(t *testing.T) {
+	state := runWorkflow(t, 1, []models.Step{
+		{Name: "a", Run: "sleep 0.1"},
+		{Name: "b", Run: "sleep 0.1"},
+		{Name: "c", Run: "sleep 0.1"},
+	})
+
+	names := []string{"a", "b", "c"}
+	for i, x := range names {
+		for _, y := range names[i+1:] {
+			if state[x].StartTime.Before(state[y].EndTime) && state[y].StartTime.Before(state[x].EndTime) {
+				t.Errorf("%s e %s rodaram juntos com parallelism 1", x, y)
+			}
+		}
+	}
+}
+
+func TestExecuteUpstreamFailure(t *testing.T) {
+	state := runWorkflow(t, 0, []models.Step{
+		{Name: "fail", Run: "exit 3"},
+		{Name: "after", Run: "true", Depends: []string{"fail"}},
+		{Name: "skipped", Run: "true", Depends: []string{"after"}},
+		{Name: "cleanup", Run: "true", Depends: []string{"after"}, TriggerRule: TriggerAllDone},
+		{Name: "alert", Run: "true", Depends: []string{"fail"}, TriggerRule: TriggerOneFailed},
+		{Name: "independent", Run: "true"},
+	})
+
+	expected := map[string]string{
+		"fail":        "failed",
+		"after":       "upstream_failed",
+		"skipped":     "upstream_failed",
+		"cleanup":     "success",
+		"alert":       "success",
+		"independent": "success",
+	}
+	for name, status := range expected {
+		if state[name].Status != status {
+			t.Errorf("step %s terminou com %s; esperado %s", name, state[name].Status, status)
+		}
+	}
+}
+
+func TestExecuteSlotFailure(t *testing.T) {
+	// Pool fora da configuração: o step falha sem rodar e os dependentes não rodam
+	state := runWorkflow(t, 0, []models.Step{
+		{Name: "pooled", Run: "true", Pool: "missing"},
+		{Name: "after", Run: "true", Depends: []string{"pooled"}},
+	})
+
+	if step := state["pooled"]; step.Status != "failed" || step.Error != "Step não iniciado: pool não configurado: missing" {
+		t.Fatalf("step sem vaga terminou com %s: %s", step.Status, step.Error)
+	}
+	if state["after"].Status != "upstream_failed" {
+		t.Fatalf("dependente terminou com %s; esperado upstream_failed", state["after"].Status)
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"orchestrium.sh/models"
+)
+
+const (
+	LimitsBackendRlimit = "rlimit"
+	LimitsBackendCgroup = "cgroup"
+)
+
+// Motivos registrados em LimitExceeded quando um step estoura um limite
+const (
+	LimitMemory    = "memory"
+	LimitCPU       = "cpu"
+	LimitOpenFiles = "open_files"
+	LimitProcesses = "processes"
+)
+
+// LimitsCommand é o primeiro argumento com que o servidor reexecuta o próprio
+// binário para definir os rlimits antes de executar o comando do step
+const LimitsCommand = "__limits"
+
+// rlimit é um limite definido pelo processo auxiliar antes do exec, para que
+// o step e todos os subprocessos já nasçam limitados
+type rlimit struct {
+	Resource int    `json:"resource"`
+	Cur      uint64 `json:"cur"`
+	Max      uint64 `json:"max"`
+}
+
+// cpuKillMargin é a folga entre o SIGXCPU e o SIGKILL do limite de CPU, para
+// que o processo tenha chance de encerrar sozinho
+const cpuKillMargin = 5
+
+// limitMessages identifica pela saída de erro os limites que, com rlimits,
+// fazem a chamada de sistema falhar dentro do processo em vez de gerar um sinal
+var limitMessages = []struct {
+	reason string
+	text   string
+}{
+	{LimitMemory, "MemoryError"},
+	{LimitMemory, "Cannot allocate memory"},
+	{LimitMemory, "out of memory"},
+	{LimitMemory, "bad_alloc"},
+	{LimitOpenFiles, "Too many open files"},
+	{LimitProcesses, "Resource temporarily unavailable"},
+	{LimitProcesses, "fork: retry"},
+}
+
+// stepLimits combina os limites do workflow com os do step; cada campo
+// definido no step substitui o do workflow
+func (we *WorkflowExecutor) stepLimits(step *models.Step) models.Limits {
+	var limits models.Limits
+	if we.limits != nil {
+		limits = *we.limits
+	}
+
+	if step.Limits != nil {
+		if step.Limits.Memory > 0 {
+			limits.Memory = step.Limits.Memory
+		}
+		if step.Limits.CPU > 0 {
+			limits.CPU = step.Limits.CPU
+		}
+		if step.Limits.OpenFiles > 0 {
+			limits.OpenFiles = step.Limits.OpenFiles
+		}
+		if step.Limits.Processes > 0 {
+			limits.Processes = step.Limits.Processes
+		}
+	}
+
+	return limits
+}
+
+// hasLimits indica se algum limite foi definido
+func hasLimits(limits models.Limits) bool {
+	return limits.Memory > 0 || limits.CPU > 0 || limits.OpenFiles > 0 || limits.Processes > 0
+}
+
+// validateLimits confere os limites de um workflow ou step
+func validateLimits(field string, limits *models.Limits, add func(field string, format string, args ...any)) {
+	if limits == nil {
+		return
+	}
+	if limits.Memory < 0 {
+		add(field+".memory", "não pode ser negativo")
+	}
+	if limits.CPU < 0 {
+		add(field+".cpu", "não pode ser negativo")
+	}
+	if limits.OpenFiles < 0 {
+		add(field+".open_files", "não pode ser negativo")
+	}
+	if limits.Processes < 0 {
+		add(field+".processes", "não pode ser negativo")
+	}
+}
+
+// limitFromOutput procura na saída de erro sinais de um limite estourado,
+// considerando apenas os limites definidos
+func limitFromOutput(limits models.Limits, stderr string) string {
+	for _, m := range limitMessages {
+		if !strings.Contains(stderr, m.text) {
+			continue
+		}
+		switch {
+		case m.reason == LimitMemory && limits.Memory > 0,
+			m.reason == LimitOpenFiles && limits.OpenFiles > 0,
+			m.reason == LimitProcesses && limits.Processes > 0:
+			return m.reason
+		}
+	}
+	return ""
+}
+
+// limitMessage descreve o limite estourado para o erro do step
+func limitMessage(reason string, limits models.Limits) string {
+	switch reason {
+	case LimitMemory:
+		return fmt.Sprintf("limite de memória excedido (%d MB)", limits.Memory)
+	case LimitCPU:
+		return fmt.Sprintf("limite de CPU excedido (%ds)", limits.CPU)
+	case LimitOpenFiles:
+		return fmt.Sprintf("limite de arquivos abertos excedido (%d)", limits.OpenFiles)
+	case LimitProcesses:
+		return fmt.Sprintf("limite de processos excedido (%d)", limits.Processes)
+	}
+	return "limite de recursos excedido"
+}
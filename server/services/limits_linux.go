@@ -0,0 +1,270 @@
+//go:build linux
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"orchestrium.sh/config"
+	"orchestrium.sh/models"
+)
+
+// limitScope aplica os limites de recursos a uma tentativa de um step. Com o
+// backend cgroup, memória e processos ficam em um cgroup v2 próprio; CPU e
+// arquivos abertos sempre usam rlimits, que o cgroup não cobre
+type limitScope struct {
+	limits   models.Limits
+	cgroup   string
+	cgroupFD *os.File
+}
+
+// newLimitScope prepara os limites da tentativa. name identifica o cgroup
+func newLimitScope(cfg *config.Config, limits models.Limits, name string) (*limitScope, error) {
+	scope := &limitScope{limits: limits}
+
+	if cfg.LimitsBackend != LimitsBackendCgroup || (limits.Memory == 0 && limits.Processes == 0) {
+		return scope, nil
+	}
+
+	if err := os.MkdirAll(cfg.CgroupRoot, 0755); err != nil {
+		return nil, fmt.Errorf("erro ao criar cgroup: %w", err)
+	}
+	// Habilita os controladores para os cgroups filhos; se já estiverem
+	// habilitados ou o sistema não permitir, a escrita abaixo acusa o problema
+	os.WriteFile(filepath.Join(cfg.CgroupRoot, "cgroup.subtree_control"), []byte("+memory +pids"), 0644)
+
+	scope.cgroup = filepath.Join(cfg.CgroupRoot, name)
+	if err := os.Mkdir(scope.cgroup, 0755); err != nil {
+		return nil, fmt.Errorf("erro ao criar cgroup: %w", err)
+	}
+
+	if limits.Memory > 0 {
+		max := strconv.FormatInt(int64(limits.Memory)*1024*1024, 10)
+		if err := scope.write("memory.max", max); err != nil {
+			scope.close()
+			return nil, err
+		}
+		// Sem swap o limite vale de fato; nem todo sistema tem o controlador
+		scope.write("memory.swap.max", "0")
+	}
+
+	if limits.Processes > 0 {
+		if err := scope.write("pids.max", strconv.Itoa(limits.Processes)); err != nil {
+			scope.close()
+			return nil, err
+		}
+	}
+
+	fd, err := os.Open(scope.cgroup)
+	if err != nil {
+		scope.close()
+		return nil, fmt.Errorf("erro ao abrir cgroup: %w", err)
+	}
+	scope.cgroupFD = fd
+
+	return scope, nil
+}
+
+func (s *limitScope) write(file string, value string) error {
+	if err := os.WriteFile(filepath.Join(s.cgroup, file), []byte(value), 0644); err != nil {
+		return fmt.Errorf("erro ao configurar cgroup (%s): %w", file, err)
+	}
+	return nil
+}
+
+// prepare faz o processo já nascer dentro do cgroup e com os rlimits. Como
+// o Go não permite definir rlimits só no filho, o comando passa pelo processo
+// auxiliar (RunLimits), que os define e então executa o comando; o processo
+// auxiliar do sandbox, que já é uma reexecução, recebe os limites na spec
+func (s *limitScope) prepare(cmd *exec.Cmd) error {
+	if s.cgroupFD != nil {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(s.cgroupFD.Fd())
+	}
+
+	limits := s.rlimits()
+	if len(limits) == 0 || cmd.Err != nil {
+		return nil
+	}
+
+	if len(cmd.Args) == 3 && cmd.Args[1] == SandboxCommand {
+		var spec sandboxSpec
+		if err := json.Unmarshal([]byte(cmd.Args[2]), &spec); err != nil {
+			return err
+		}
+		spec.Rlimits = limits
+		data, err := json.Marshal(spec)
+		if err != nil {
+			return err
+		}
+		cmd.Args[2] = string(data)
+		return nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("erro ao localizar o executável do servidor: %w", err)
+	}
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return err
+	}
+
+	cmd.Args = append([]string{self, LimitsCommand, string(data), cmd.Path}, cmd.Args...)
+	cmd.Path = self
+	return nil
+}
+
+// rlimits monta os rlimits da tentativa. RLIMIT_NPROC conta todos os
+// processos do usuário e não vale para root; para um limite exato de
+// processos use o backend cgroup, que também cuida da memória
+func (s *limitScope) rlimits() []rlimit {
+	limits := make([]rlimit, 0)
+	add := func(resource int, value uint64) {
+		limits = append(limits, rlimit{Resource: resource, Cur: value, Max: value})
+	}
+
+	if s.limits.CPU > 0 {
+		limits = append(limits, rlimit{
+			Resource: unix.RLIMIT_CPU,
+			Cur:      uint64(s.limits.CPU),
+			Max:      uint64(s.limits.CPU) + cpuKillMargin,
+		})
+	}
+	if s.limits.OpenFiles > 0 {
+		add(unix.RLIMIT_NOFILE, uint64(s.limits.OpenFiles))
+	}
+
+	if s.cgroup == "" {
+		if s.limits.Memory > 0 {
+			add(unix.RLIMIT_AS, uint64(s.limits.Memory)*1024*1024)
+		}
+		if s.limits.Processes > 0 {
+			add(unix.RLIMIT_NPROC, uint64(s.limits.Processes))
+		}
+	}
+
+	return limits
+}
+
+// setRlimits define os rlimits do próprio processo, herdados no exec
+func setRlimits(limits []rlimit) error {
+	for _, limit := range limits {
+		value := unix.Rlimit{Cur: limit.Cur, Max: limit.Max}
+		if err := unix.Setrlimit(limit.Resource, &value); err != nil {
+			return fmt.Errorf("erro ao aplicar %s: %w", rlimitName(limit.Resource), err)
+		}
+	}
+	return nil
+}
+
+// rlimitName descreve o recurso nas mensagens de erro
+func rlimitName(resource int) string {
+	switch resource {
+	case unix.RLIMIT_CPU:
+		return "limite de CPU"
+	case unix.RLIMIT_NOFILE:
+		return "limite de arquivos abertos"
+	case unix.RLIMIT_AS:
+		return "limite de memória"
+	case unix.RLIMIT_NPROC:
+		return "limite de processos"
+	}
+	return fmt.Sprintf("limite %d", resource)
+}
+
+// RunLimits é o processo auxiliar dos rlimits: define os limites e executa
+// o comando no lugar dele. Não retorna em caso de sucesso
+func RunLimits(args []string) {
+	if err := runLimits(args); err != nil {
+		fmt.Fprintf(os.Stderr, "limits: %v\n", err)
+		os.Exit(126)
+	}
+}
+
+func runLimits(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("uso: %s <limites> <caminho> <argumentos...>", LimitsCommand)
+	}
+
+	var limits []rlimit
+	if err := json.Unmarshal([]byte(args[0]), &limits); err != nil {
+		return fmt.Errorf("limites inválidos: %w", err)
+	}
+	if err := setRlimits(limits); err != nil {
+		return err
+	}
+
+	return syscall.Exec(args[1], args[2:], os.Environ())
+}
+
+// exceeded retorna qual limite encerrou a tentativa, se algum. O cgroup
+// registra os eventos; com rlimits vale o sinal e, na falta dele, a saída de erro
+func (s *limitScope) exceeded(signal string, stderr string) string {
+	if s.limits.CPU > 0 && signal == unix.SignalName(unix.SIGXCPU) {
+		return LimitCPU
+	}
+
+	if s.cgroup != "" {
+		if s.limits.Memory > 0 && s.event("memory.events", "oom_kill") > 0 {
+			return LimitMemory
+		}
+		if s.limits.Processes > 0 && s.event("pids.events", "max") > 0 {
+			return LimitProcesses
+		}
+		limits := s.limits
+		limits.Memory, limits.Processes = 0, 0
+		return limitFromOutput(limits, stderr)
+	}
+
+	return limitFromOutput(s.limits, stderr)
+}
+
+// event lê um contador de um arquivo de eventos do cgroup
+func (s *limitScope) event(file string, key string) int {
+	data, err := os.ReadFile(filepath.Join(s.cgroup, file))
+	if err != nil {
+		return 0
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) == 2 && string(fields[0]) == key {
+			n, _ := strconv.Atoi(string(fields[1]))
+			return n
+		}
+	}
+	return 0
+}
+
+// close encerra o que restou no cgroup e o remove
+func (s *limitScope) close() {
+	if s.cgroupFD != nil {
+		s.cgroupFD.Close()
+	}
+	if s.cgroup == "" {
+		return
+	}
+
+	os.WriteFile(filepath.Join(s.cgroup, "cgroup.kill"), []byte("1"), 0644)
+	for range 10 {
+		if err := os.Remove(s.cgroup); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	fmt.Printf("[CGROUP] Não foi possível remover %s\n", s.cgroup)
+}
@@ -0,0 +1,40 @@
+//go:build !linux
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"orchestrium.sh/config"
+	"orchestrium.sh/models"
+)
+
+// limitScope não tem implementação fora do Linux; steps com limites falham
+// em vez de rodar sem eles
+type limitScope struct {
+	limits models.Limits
+}
+
+func newLimitScope(cfg *config.Config, limits models.Limits, name string) (*limitScope, error) {
+	if hasLimits(limits) {
+		return nil, fmt.Errorf("limites de recursos só são suportados no Linux")
+	}
+	return &limitScope{limits: limits}, nil
+}
+
+func (s *limitScope) prepare(cmd *exec.Cmd) error {
+	return nil
+}
+
+func (s *limitScope) exceeded(signal string, stderr string) string {
+	return ""
+}
+
+func (s *limitScope) close() {}
+
+func RunLimits(args []string) {
+	fmt.Fprintln(os.Stderr, "limits: limites de recursos só são suportados no Linux")
+	os.Exit(126)
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"orchestrium.sh/models"
+)
+
+// maxOutputTail limita quanto da saída de cada stream fica em ExecutionState
+const maxOutputTail = 64 * 1024
+
+// maxLogLine limita o tamanho de uma linha do log. Saídas maiores sem quebra
+// de linha são gravadas em pedaços desse tamanho, e linhas maiores em logs
+// antigos são truncadas na leitura
+const maxLogLine = 64 * 1024
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	StreamSystem = "system"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// runDir retorna o diretório onde ficam os arquivos de uma execução
+func runDir(workflowID string, runID string) string {
+	return filepath.Join("workflows", workflowID, "runs", runID)
+}
+
+// safeFileName converte o nome do step em um nome de arquivo seguro
+func safeFileName(stepName string) string {
+	return unsafeFileChars.ReplaceAllString(stepName, "_")
+}
+
+// logFileName retorna o nome do arquivo de log de um step
+func logFileName(stepName string) string {
+	return safeFileName(stepName) + ".log"
+}
+
+// stepLog grava as linhas de stdout/stderr de um step em um único arquivo,
+// cada uma com timestamp e o stream de origem
+type stepLog struct {
+	mu sync.Mutex
+	// file nil descarta as linhas; é o caso do agente remoto, que só as
+	// encaminha ao servidor
+	file *os.File
+	// mask, se definido, esconde os valores dos secrets antes de gravar
+	mask *strings.Replacer
+}
+
+func openStepLog(path string) (*stepLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stepLog{file: file}, nil
+}
+
+// writeLine grava uma linha no formato "<timestamp> <stream> <texto>"
+func (l *stepLog) writeLine(stream string, line string) {
+	if l.file == nil {
+		return
+	}
+	fmt.Fprintf(l.file, "%s %s %s\n", time.Now().UTC().Format(time.RFC3339Nano), stream, line)
+}
+
+// redact aplica a máscara de secrets ao texto
+func (l *stepLog) redact(text string) string {
+	if l.mask == nil {
+		return text
+	}
+	return l.mask.Replace(text)
+}
+
+// System registra uma mensagem do próprio executor no log do step
+func (l *stepLog) System(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.writeLine(StreamSystem, l.redact(fmt.Sprintf(format, args...)))
+}
+
+// Stream retorna um io.Writer que quebra a saída em linhas para o stream informado
+func (l *stepLog) Stream(stream string) *streamWriter {
+	return &streamWriter{log: l, stream: stream}
+}
+
+func (l *stepLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// streamWriter acumula a saída de um stream até formar linhas completas e
+// guarda o final da saída para ExecutionState
+type streamWriter struct {
+	log     *stepLog
+	stream  string
+	partial []byte
+	tail    []byte
+	// onLine, se definido, recebe cada linha completa do stream
+	onLine func(line string)
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.log.mu.Lock()
+	defer w.log.mu.Unlock()
+
+	w.tail = append(w.tail, p...)
+	if len(w.tail) > maxOutputTail {
+		w.tail = w.tail[len(w.tail)-maxOutputTail:]
+	}
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(strings.TrimSuffix(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+
+	// Sem quebra de linha, a saída acumulada não pode crescer sem limite
+	for len(w.partial) >= maxLogLine {
+		w.emit(string(w.partial[:maxLogLine]))
+		w.partial = w.partial[maxLogLine:]
+	}
+
+	return len(p), nil
+}
+
+// Flush grava a última linha, mesmo sem quebra de linha no final
+func (w *streamWriter) Flush() {
+	w.log.mu.Lock()
+	defer w.log.mu.Unlock()
+
+	if len(w.partial) > 0 {
+		w.emit(string(w.partial))
+		w.partial = nil
+	}
+}
+
+// emit grava uma linha completa. Deve ser chamada com w.log.mu travado
+func (w *streamWriter) emit(line string) {
+	line = w.log.redact(line)
+	w.log.writeLine(w.stream, line)
+	if w.onLine != nil {
+		w.onLine(line)
+	}
+}
+
+// Reset descarta o final da saída capturada, para que cada tentativa
+// guarde só a própria saída
+func (w *streamWriter) Reset() {
+	w.log.mu.Lock()
+	defer w.log.mu.Unlock()
+
+	w.tail = nil
+}
+
+// Tail retorna o final da saída capturada
+func (w *streamWriter) Tail() string {
+	w.log.mu.Lock()
+	defer w.log.mu.Unlock()
+
+	return w.log.redact(string(w.tail))
+}
+
+// readStepLog lê um arquivo de log, filtrando pelo stream quando informado
+func readStepLog(path string, stream string) ([]models.LogEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]models.LogEntry, 0)
+	reader := bufio.NewReader(file)
+
+	for {
+		// A linha inclui o timestamp e o stream antes do texto
+		line, err := readLogLine(reader, maxLogLine+128)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entries, err
+		}
+
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) < 2 {
+			continue
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err != nil {
+			continue
+		}
+
+		if stream != "" && parts[1] != stream {
+			continue
+		}
+
+		entry := models.LogEntry{Time: ts, Stream: parts[1]}
+		if len(parts) == 3 {
+			entry.Line = parts[2]
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// readLogLine lê uma linha inteira, guardando no máximo limit bytes dela
+func readLogLine(reader *bufio.Reader, limit int) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if room := limit - len(line); room > 0 {
+			line = append(line, chunk[:min(len(chunk), room)]...)
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// isValidRunID evita que o id da execução seja usado para sair de runs/
+func isValidRunID(runID string) bool {
+	return runID != "" && runID != "." && runID != ".." && !unsafeFileChars.MatchString(runID)
+}
+
+// GetRunLogs lista os steps que têm log na execução informada
+func (ws *WorkflowService) GetRunLogs(id string, runID string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join("workflows", id, "conf.yaml")); err != nil {
+		return nil, fmt.Errorf("workflow não encontrado")
+	}
+
+	if !isValidRunID(runID) {
+		return nil, fmt.Errorf("execução não encontrada")
+	}
+
+	entries, err := os.ReadDir(runDir(id, runID))
+	if err != nil {
+		return nil, fmt.Errorf("execução não encontrada")
+	}
+
+	steps := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			steps = append(steps, strings.TrimSuffix(entry.Name(), ".log"))
+		}
+	}
+	sort.Strings(steps)
+
+	return steps, nil
+}
+
+// GetStepLog retorna as linhas de log de um step em uma execução
+func (ws *WorkflowService) GetStepLog(id string, runID string, stepName string, stream string) ([]models.LogEntry, error) {
+	if _, err := os.Stat(filepath.Join("workflows", id, "conf.yaml")); err != nil {
+		return nil, fmt.Errorf("workflow não encontrado")
+	}
+
+	if !isValidRunID(runID) {
+		return nil, fmt.Errorf("execução não encontrada")
+	}
+
+	entries, err := readStepLog(filepath.Join(runDir(id, runID), logFileName(stepName)), stream)
+	if err != nil {
+		return nil, fmt.Errorf("log não encontrado")
+	}
+
+	return entries, nil
+}
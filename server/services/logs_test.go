@@ -0,0 +1,66 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamWriterSplitsLongOutput(t *testing.T) {
+	log := &stepLog{}
+	w := log.Stream(StreamStdout)
+
+	var lines []string
+	w.onLine = func(line string) { lines = append(lines, line) }
+
+	// Mais de dois pedaços sem nenhuma quebra de linha
+	chunk := bytes.Repeat([]byte("x"), 1024)
+	for range 2*maxLogLine/len(chunk) + 1 {
+		w.Write(chunk)
+	}
+	if len(lines) != 2 || len(lines[0]) != maxLogLine || len(lines[1]) != maxLogLine {
+		t.Fatalf("linhas emitidas = %d; esperado 2 pedaços de %d bytes", len(lines), maxLogLine)
+	}
+	if len(w.partial) >= maxLogLine {
+		t.Fatalf("saída acumulada com %d bytes", len(w.partial))
+	}
+
+	w.Write([]byte("fim\r\nsem quebra"))
+	w.Flush()
+	if got := lines[len(lines)-2:]; !strings.HasSuffix(got[0], "xfim") || got[1] != "sem quebra" {
+		t.Fatalf("últimas linhas = %q", got)
+	}
+}
+
+func TestReadStepLogLongLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "step.log")
+	ts := time.Now().UTC().Format(time.RFC3339Nano)
+
+	long := strings.Repeat("y", 5*1024*1024)
+	content := ts + " stdout " + long + "\n" + ts + " stderr depois\n" + ts + " stdout última"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readStepLog(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("entradas = %d; esperado 3", len(entries))
+	}
+	if len(entries[0].Line) > maxLogLine+128 || !strings.HasPrefix(entries[0].Line, "yyy") {
+		t.Fatalf("linha longa com %d bytes; esperado truncada", len(entries[0].Line))
+	}
+	if entries[1].Stream != StreamStderr || entries[1].Line != "depois" || entries[2].Line != "última" {
+		t.Fatalf("entradas após a linha longa = %+v, %+v", entries[1], entries[2])
+	}
+
+	stderr, err := readStepLog(path, StreamStderr)
+	if err != nil || len(stderr) != 1 {
+		t.Fatalf("filtro por stream = %v, %v", stderr, err)
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputMarker identifica linhas de stdout que definem um output do step,
+// no formato "::output chave=valor"
+const outputMarker = "::output "
+
+// parseOutput interpreta uma linha "chave=valor"
+func parseOutput(line string) (string, string, bool) {
+	key, value, found := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// collectOutput registra os outputs escritos no stdout com o marcador
+func (sr *stepRun) collectOutput(line string) {
+	if !strings.HasPrefix(line, outputMarker) {
+		return
+	}
+	if key, value, ok := parseOutput(strings.TrimPrefix(line, outputMarker)); ok {
+		sr.outputs[key] = value
+	}
+}
+
+// resetOutputs limpa os outputs e o arquivo de outputs antes de uma tentativa
+func (sr *stepRun) resetOutputs() error {
+	sr.log.mu.Lock()
+	sr.outputs = make(map[string]string)
+	sr.log.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(sr.outputFile), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(sr.outputFile, nil, 0644)
+}
+
+// readOutputFile lê os outputs que o step gravou no arquivo indicado por
+// ORCHESTRIUM_OUTPUT, uma linha "chave=valor" por output. O arquivo tem
+// precedência sobre o marcador no stdout. Os valores passam pela mesma
+// máscara de secrets do log, como os do marcador
+func (sr *stepRun) readOutputFile() {
+	file, err := os.Open(sr.outputFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	sr.log.mu.Lock()
+	defer sr.log.mu.Unlock()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := parseOutput(line); ok {
+			sr.outputs[key] = sr.log.redact(value)
+		}
+	}
+}
+
+// envName converte um nome qualquer em parte de nome de variável de ambiente
+func envName(name string) string {
+	return strings.ToUpper(unsafeEnvChars.ReplaceAllString(name, "_"))
+}
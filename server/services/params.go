@@ -0,0 +1,189 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"orchestrium.sh/models"
+)
+
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamBool   = "bool"
+	ParamDate   = "date"
+	ParamEnum   = "enum"
+)
+
+var paramTypes = []string{ParamString, ParamInt, ParamBool, ParamDate, ParamEnum}
+
+// paramDateLayout é o formato aceito e repassado aos steps para parâmetros date
+const paramDateLayout = "2006-01-02"
+
+// validateParamDecls confere as declarações de params do conf.yaml
+func validateParamDecls(params []models.Param, add func(field string, format string, args ...any)) {
+	seen := make(map[string]bool)
+
+	for i, param := range params {
+		field := fmt.Sprintf("params[%d]", i)
+
+		if param.Name == "" {
+			add(field+".name", "nome do parâmetro é obrigatório")
+		} else if unsafeEnvChars.MatchString(param.Name) {
+			add(field+".name", "use apenas letras, números e _")
+		} else if seen[param.Name] {
+			add(field+".name", "nome duplicado: %s", param.Name)
+		}
+		seen[param.Name] = true
+
+		if !slices.Contains(paramTypes, param.Type) {
+			add(field+".type", "deve ser um de: %s", strings.Join(paramTypes, ", "))
+			continue
+		}
+
+		if param.Type == ParamEnum && len(param.Values) == 0 {
+			add(field+".values", "enum precisa de ao menos um valor")
+		}
+
+		if param.Default != nil {
+			if _, err := normalizeParam(param, param.Default); err != nil {
+				add(field+".default", "%v", err)
+			}
+		}
+	}
+}
+
+// validateScheduledParams exige default nos parâmetros obrigatórios de um
+// workflow que vai ser agendado, já que as execuções do agendamento não
+// informam valores. Disparos manuais continuam podendo informá-los
+func validateScheduledParams(params []models.Param) []models.ValidationError {
+	errs := make([]models.ValidationError, 0)
+	for i, param := range params {
+		if param.Required && param.Default == nil {
+			errs = append(errs, models.ValidationError{
+				Field:   fmt.Sprintf("params[%d].default", i),
+				Message: "parâmetro obrigatório precisa de default em workflow agendado",
+			})
+		}
+	}
+	return errs
+}
+
+// resolveParams combina os valores informados no disparo com os defaults
+// declarados e converte cada um para o texto passado aos steps. Execuções
+// agendadas não informam valores e usam apenas os defaults
+func resolveParams(params []models.Param, supplied map[string]any) (map[string]string, []models.ValidationError) {
+	errs := make([]models.ValidationError, 0)
+	values := make(map[string]string)
+
+	declared := make(map[string]bool)
+	for _, param := range params {
+		declared[param.Name] = true
+		field := "params." + param.Name
+
+		raw, exists := supplied[param.Name]
+		if !exists || raw == nil {
+			raw = param.Default
+		}
+
+		if raw == nil {
+			if param.Required {
+				errs = append(errs, models.ValidationError{Field: field, Message: "parâmetro obrigatório"})
+			}
+			continue
+		}
+
+		value, err := normalizeParam(param, raw)
+		if err != nil {
+			errs = append(errs, models.ValidationError{Field: field, Message: err.Error()})
+			continue
+		}
+		values[param.Name] = value
+	}
+
+	for name := range supplied {
+		if !declared[name] {
+			errs = append(errs, models.ValidationError{Field: "params." + name, Message: "parâmetro não declarado"})
+		}
+	}
+
+	return values, errs
+}
+
+// normalizeParam valida o valor conforme o tipo do parâmetro. Valores podem
+// chegar como texto ou já tipados (JSON e YAML)
+func normalizeParam(param models.Param, raw any) (string, error) {
+	switch param.Type {
+	case ParamInt:
+		switch v := raw.(type) {
+		case int:
+			return strconv.Itoa(v), nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case uint64:
+			return strconv.FormatUint(v, 10), nil
+		case float64:
+			if v != math.Trunc(v) {
+				return "", fmt.Errorf("esperado inteiro, recebido %v", v)
+			}
+			return strconv.FormatInt(int64(v), 10), nil
+		case string:
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("esperado inteiro, recebido %q", v)
+			}
+			return strconv.FormatInt(n, 10), nil
+		}
+
+	case ParamBool:
+		switch v := raw.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return "", fmt.Errorf("esperado booleano, recebido %q", v)
+			}
+			return strconv.FormatBool(b), nil
+		}
+
+	case ParamDate:
+		var text string
+		switch v := raw.(type) {
+		case string:
+			text = strings.TrimSpace(v)
+		case time.Time:
+			return v.Format(paramDateLayout), nil
+		default:
+			text = fmt.Sprint(v)
+		}
+		d, err := time.Parse(paramDateLayout, text)
+		if err != nil {
+			return "", fmt.Errorf("esperada data no formato AAAA-MM-DD, recebido %q", text)
+		}
+		return d.Format(paramDateLayout), nil
+
+	case ParamEnum:
+		text := fmt.Sprint(raw)
+		if !slices.Contains(param.Values, text) {
+			return "", fmt.Errorf("valor %q não está entre: %s", text, strings.Join(param.Values, ", "))
+		}
+		return text, nil
+
+	case ParamString:
+		switch v := raw.(type) {
+		case string:
+			return v, nil
+		case map[string]any, []any:
+			return "", fmt.Errorf("esperado texto")
+		default:
+			return fmt.Sprint(v), nil
+		}
+	}
+
+	return "", fmt.Errorf("valor %v inválido para o tipo %s", raw, param.Type)
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"orchestrium.sh/models"
+)
+
+func TestNormalizeParam(t *testing.T) {
+	enum := models.Param{Type: ParamEnum, Values: []string{"dev", "prod"}}
+
+	tests := []struct {
+		name     string
+		param    models.Param
+		raw      any
+		expected string
+		fails    bool
+	}{
+		{"int de JSON", models.Param{Type: ParamInt}, float64(42), "42", false},
+		{"int do YAML", models.Param{Type: ParamInt}, uint64(7), "7", false},
+		{"int em texto", models.Param{Type: ParamInt}, " -3 ", "-3", false},
+		{"int com fração", models.Param{Type: ParamInt}, 1.5, "", true},
+		{"int inválido", models.Param{Type: ParamInt}, "dez", "", true},
+		{"int de booleano", models.Param{Type: ParamInt}, true, "", true},
+
+		{"bool", models.Param{Type: ParamBool}, true, "true", false},
+		{"bool em texto", models.Param{Type: ParamBool}, "0", "false", false},
+		{"bool inválido", models.Param{Type: ParamBool}, "talvez", "", true},
+		{"bool de número", models.Param{Type: ParamBool}, float64(1), "", true},
+
+		{"date em texto", models.Param{Type: ParamDate}, "2026-02-28", "2026-02-28", false},
+		{"date do YAML", models.Param{Type: ParamDate}, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), "2026-03-01", false},
+		{"date inexistente", models.Param{Type: ParamDate}, "2026-02-30", "", true},
+		{"date em outro formato", models.Param{Type: ParamDate}, "01/02/2026", "", true},
+
+		{"enum válido", enum, "prod", "prod", false},
+		{"enum fora da lista", enum, "staging", "", true},
+
+		{"string", models.Param{Type: ParamString}, "texto", "texto", false},
+		{"string de número", models.Param{Type: ParamString}, float64(3), "3", false},
+		{"string de objeto", models.Param{Type: ParamString}, map[string]any{"a": 1}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := normalizeParam(tt.param, tt.raw)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("normalizeParam(%v) = %q; esperado erro", tt.raw, value)
+				}
+				return
+			}
+			if err != nil || value != tt.expected {
+				t.Fatalf("normalizeParam(%v) = %q, %v; esperado %q", tt.raw, value, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveParams(t *testing.T) {
+	params := []models.Param{
+		{Name: "day", Type: ParamDate, Required: true},
+		{Name: "limit", Type: ParamInt, Default: 10},
+		{Name: "env", Type: ParamEnum, Values: []string{"dev", "prod"}, Default: "dev"},
+		{Name: "note", Type: ParamString},
+	}
+
+	tests := []struct {
+		name     string
+		supplied map[string]any
+		values   map[string]string
+		fields   []string
+	}{
+		{
+			name:     "defaults e valores informados",
+			supplied: map[string]any{"day": "2026-01-02", "limit": "5"},
+			values:   map[string]string{"day": "2026-01-02", "limit": "5", "env": "dev"},
+			fields:   []string{},
+		},
+		{
+			name:     "nulo usa o default",
+			supplied: map[string]any{"day": "2026-01-02", "env": nil},
+			values:   map[string]string{"day": "2026-01-02", "limit": "10", "env": "dev"},
+			fields:   []string{},
+		},
+		{
+			name:     "obrigatório ausente",
+			supplied: nil,
+			values:   map[string]string{"limit": "10", "env": "dev"},
+			fields:   []string{"params.day"},
+		},
+		{
+			name:     "tipo inválido e parâmetro não declarado",
+			supplied: map[string]any{"day": "2026-01-02", "limit": "muitos", "extra": "x"},
+			values:   map[string]string{"day": "2026-01-02", "env": "dev"},
+			fields:   []string{"params.limit", "params.extra"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, errs := resolveParams(params, tt.supplied)
+
+			fields := make([]string, 0, len(errs))
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Fatalf("erros em %v; esperado %v", fields, tt.fields)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Fatalf("valores = %v; esperado %v", values, tt.values)
+			}
+		})
+	}
+}
+
+func TestValidateScheduledParams(t *testing.T) {
+	params := []models.Param{
+		{Name: "day", Type: ParamDate, Required: true},
+		{Name: "limit", Type: ParamInt, Required: true, Default: 10},
+		{Name: "note", Type: ParamString},
+	}
+
+	errs := validateScheduledParams(params)
+	if len(errs) != 1 || errs[0].Field != "params[0].default" {
+		t.Fatalf("validateScheduledParams = %v; esperado erro só em params[0]", errs)
+	}
+
+	// A regra não vale para a validação comum, usada também no disparo manual
+	var decl []string
+	validateParamDecls(params, func(field string, format string, args ...any) {
+		decl = append(decl, field)
+	})
+	if len(decl) != 0 {
+		t.Fatalf("validateParamDecls = %v; esperado sem erros", decl)
+	}
+}
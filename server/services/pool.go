@@ -0,0 +1,350 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"orchestrium.sh/models"
+)
+
+// workerPool limita quantas vagas estão ocupadas ao mesmo tempo no servidor
+// inteiro, somando todos os workflows. É usado pela fila global de steps e
+// pelos pools nomeados da configuração, onde um step pode ocupar mais de uma
+// vaga. Steps sem vaga esperam em fila; a vaga vai para a maior prioridade,
+// que cresce um ponto a cada aging de espera para que prioridades baixas não
+// fiquem esperando para sempre
+type workerPool struct {
+	mu      sync.Mutex
+	limit   int
+	aging   time.Duration
+	running int
+	holders []*poolTicket
+	waiting []*poolTicket
+
+	// Estatísticas de espera desde o início do servidor
+	served    int
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+// poolTicket é um step aguardando ou ocupando vagas
+type poolTicket struct {
+	workflowID string
+	runID      string
+	step       string
+	priority   int
+	slots      int
+	enqueued   time.Time
+	since      time.Time
+	granted    bool
+	ready      chan struct{}
+	// queued, se definida, é chamada quando o ticket precisa esperar na fila
+	queued func()
+}
+
+// newWorkerPool cria o pool; limit zero significa sem limite e aging zero
+// desliga o envelhecimento
+func newWorkerPool(limit int, aging time.Duration) *workerPool {
+	return &workerPool{limit: limit, aging: aging}
+}
+
+// fits indica se as vagas do ticket cabem no pool. Deve ser chamada com p.mu travado
+func (p *workerPool) fits(ticket *poolTicket) bool {
+	return p.limit <= 0 || p.running+ticket.slots <= p.limit
+}
+
+// acquire bloqueia até haver vagas para o ticket ou o contexto ser encerrado
+func (p *workerPool) acquire(ctx context.Context, ticket *poolTicket) error {
+	ticket.enqueued = time.Now()
+	ticket.ready = make(chan struct{})
+
+	p.mu.Lock()
+	if len(p.waiting) == 0 && p.fits(ticket) {
+		p.grant(ticket)
+		p.mu.Unlock()
+		return nil
+	}
+	p.waiting = append(p.waiting, ticket)
+	p.mu.Unlock()
+
+	if ticket.queued != nil {
+		ticket.queued()
+	}
+
+	select {
+	case <-ticket.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	if ticket.granted {
+		// A vaga chegou junto com o cancelamento; devolve para o próximo
+		p.mu.Unlock()
+		p.release(ticket)
+		return context.Cause(ctx)
+	}
+	p.waiting = slices.DeleteFunc(p.waiting, func(t *poolTicket) bool { return t == ticket })
+	// O ticket que saiu podia estar segurando a fila
+	p.dispatch()
+	p.mu.Unlock()
+
+	return context.Cause(ctx)
+}
+
+// release devolve as vagas do ticket e as entrega aos próximos da fila
+func (p *workerPool) release(ticket *poolTicket) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.running -= ticket.slots
+	p.holders = slices.DeleteFunc(p.holders, func(t *poolTicket) bool { return t == ticket })
+	p.dispatch()
+}
+
+// dispatch entrega vagas aos tickets da fila enquanto o próximo couber. O
+// próximo não é pulado quando não cabe, para que steps que ocupam muitas
+// vagas não sejam ultrapassados para sempre. Deve ser chamada com p.mu travado
+func (p *workerPool) dispatch() {
+	for len(p.waiting) > 0 {
+		next := p.next(time.Now())
+		ticket := p.waiting[next]
+		if !p.fits(ticket) {
+			return
+		}
+		p.waiting = slices.Delete(p.waiting, next, next+1)
+		p.grant(ticket)
+		close(ticket.ready)
+	}
+}
+
+// grant registra o ticket como ocupante das vagas. Deve ser chamada com p.mu travado
+func (p *workerPool) grant(ticket *poolTicket) {
+	ticket.granted = true
+	ticket.since = time.Now()
+	p.running += ticket.slots
+	p.holders = append(p.holders, ticket)
+	p.record(ticket.since.Sub(ticket.enqueued))
+}
+
+// effectivePriority soma à prioridade um ponto por intervalo de aging esperado
+func (p *workerPool) effectivePriority(ticket *poolTicket, now time.Time) int {
+	if p.aging <= 0 {
+		return ticket.priority
+	}
+	return ticket.priority + int(now.Sub(ticket.enqueued)/p.aging)
+}
+
+// next escolhe o índice do próximo ticket: maior prioridade efetiva e, no
+// empate, quem chegou primeiro. Deve ser chamada com p.mu travado
+func (p *workerPool) next(now time.Time) int {
+	best := 0
+	for i, ticket := range p.waiting[1:] {
+		if p.effectivePriority(ticket, now) > p.effectivePriority(p.waiting[best], now) {
+			best = i + 1
+		}
+	}
+	return best
+}
+
+// record acumula o tempo de espera de um step que recebeu vaga. Deve ser
+// chamada com p.mu travado
+func (p *workerPool) record(wait time.Duration) {
+	p.served++
+	p.totalWait += wait
+	p.maxWait = max(p.maxWait, wait)
+}
+
+// stats monta o retrato atual da fila
+func (p *workerPool) stats() models.QueueStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	stats := models.QueueStats{
+		MaxRunningSteps: p.limit,
+		Running:         p.running,
+		Waiting:         len(p.waiting),
+		Served:          p.served,
+		MaxWait:         p.maxWait,
+		Items:           make([]models.QueueItem, 0, len(p.waiting)),
+	}
+	if p.served > 0 {
+		stats.AvgWait = p.totalWait / time.Duration(p.served)
+	}
+
+	for _, ticket := range p.waiting {
+		wait := now.Sub(ticket.enqueued)
+		stats.OldestWait = max(stats.OldestWait, wait)
+		stats.Items = append(stats.Items, models.QueueItem{
+			WorkflowId: ticket.workflowID,
+			RunId:      ticket.runID,
+			Step:       ticket.step,
+			Slots:      ticket.slots,
+			Priority:   ticket.priority,
+			Effective:  p.effectivePriority(ticket, now),
+			EnqueuedAt: ticket.enqueued,
+			Wait:       wait,
+		})
+	}
+
+	return stats
+}
+
+// holderList lista os steps que ocupam vagas do pool
+func (p *workerPool) holderList() []models.PoolHolder {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	holders := make([]models.PoolHolder, 0, len(p.holders))
+	for _, ticket := range p.holders {
+		holders = append(holders, models.PoolHolder{
+			WorkflowId: ticket.workflowID,
+			RunId:      ticket.runID,
+			Step:       ticket.step,
+			Slots:      ticket.slots,
+			Since:      ticket.since,
+		})
+	}
+	return holders
+}
+
+// acquireSlot espera as vagas do step: primeiro no pool nomeado, se houver,
+// e depois no pool global, para não segurar vaga global enquanto o pool
+// nomeado está cheio. O step só aparece como "queued" se tiver que esperar, e
+// a execução só enquanto nenhum step dela começou. A função retornada devolve
+// as vagas
+func (we *WorkflowExecutor) acquireSlot(ctx context.Context, step *models.Step) (func(), error) {
+	var pools []*workerPool
+	var tickets []*poolTicket
+
+	if step.Pool != "" {
+		pool, exists := we.pools[step.Pool]
+		if !exists {
+			return nil, fmt.Errorf("pool não configurado: %s", step.Pool)
+		}
+		pools = append(pools, pool)
+		tickets = append(tickets, we.newTicket(step, poolSlots(step)))
+	}
+	if we.pool != nil {
+		pools = append(pools, we.pool)
+		tickets = append(tickets, we.newTicket(step, 1))
+	}
+
+	if len(pools) == 0 {
+		return func() {}, nil
+	}
+
+	for _, ticket := range tickets {
+		ticket.queued = func() { we.markStepQueued(step.Name) }
+	}
+
+	releaseAll := func(n int) {
+		for i := n - 1; i >= 0; i-- {
+			pools[i].release(tickets[i])
+		}
+	}
+
+	for i, pool := range pools {
+		if err := pool.acquire(ctx, tickets[i]); err != nil {
+			releaseAll(i)
+			return nil, err
+		}
+	}
+
+	we.mu.Lock()
+	we.slots++
+	if we.status == "queued" {
+		we.status = "running"
+	}
+	we.mu.Unlock()
+
+	return func() {
+		we.mu.Lock()
+		we.slots--
+		we.mu.Unlock()
+
+		releaseAll(len(pools))
+	}, nil
+}
+
+// markStepQueued registra que o step espera vaga. A execução só volta a
+// "queued" se nenhum step dela começou, para não parecer parada no meio
+func (we *WorkflowExecutor) markStepQueued(name string) {
+	we.mu.Lock()
+	we.state[name].Status = "queued"
+	if !we.started && we.slots == 0 {
+		we.status = "queued"
+	}
+	we.mu.Unlock()
+	we.persist()
+}
+
+// newTicket monta o pedido de vagas do step
+func (we *WorkflowExecutor) newTicket(step *models.Step, slots int) *poolTicket {
+	return &poolTicket{
+		workflowID: we.workflowID,
+		runID:      we.runID,
+		step:       step.Name,
+		priority:   we.stepPriority(step),
+		slots:      slots,
+	}
+}
+
+// poolSlots retorna quantas vagas do pool nomeado o step ocupa
+func poolSlots(step *models.Step) int {
+	if step.PoolSlots > 0 {
+		return step.PoolSlots
+	}
+	return 1
+}
+
+// stepPriority retorna a prioridade do step na fila: a prioridade informada
+// no disparo manual vale para todos os steps; sem ela, a do step tem
+// precedência sobre a do workflow
+func (we *WorkflowExecutor) stepPriority(step *models.Step) int {
+	if we.priorityOverride == nil && step.Priority != nil {
+		return *step.Priority
+	}
+	return we.priority
+}
+
+// GetQueue retorna a ocupação do pool global e os steps aguardando vaga
+func (ws *WorkflowService) GetQueue() models.QueueStats {
+	return ws.pool.stats()
+}
+
+// newPools cria os pools nomeados declarados na configuração
+func newPools(sizes map[string]int, aging time.Duration) map[string]*workerPool {
+	pools := make(map[string]*workerPool, len(sizes))
+	for name, size := range sizes {
+		pools[name] = newWorkerPool(size, aging)
+	}
+	return pools
+}
+
+// GetPools retorna a ocupação de cada pool nomeado, quem ocupa as vagas e
+// quem aguarda por elas
+func (ws *WorkflowService) GetPools() []models.PoolStats {
+	pools := make([]models.PoolStats, 0, len(ws.pools))
+	for name, pool := range ws.pools {
+		stats := pool.stats()
+		pools = append(pools, models.PoolStats{
+			Name:    name,
+			Slots:   stats.MaxRunningSteps,
+			Used:    stats.Running,
+			Holders: pool.holderList(),
+			Waiting: stats.Items,
+		})
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Name < pools[j].Name
+	})
+
+	return pools
+}
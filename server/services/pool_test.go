@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolNextAging(t *testing.T) {
+	p := newWorkerPool(1, time.Minute)
+	now := time.Now()
+	p.waiting = []*poolTicket{
+		{step: "old-low", priority: 0, enqueued: now.Add(-9 * time.Minute)},
+		{step: "new-high", priority: 10, enqueued: now},
+		{step: "mid", priority: 5, enqueued: now.Add(-time.Minute)},
+	}
+
+	// 0 + 9 de aging ainda perde para 10
+	if got := p.waiting[p.next(now)].step; got != "new-high" {
+		t.Fatalf("next = %s; esperado new-high", got)
+	}
+
+	// Com 11 minutos de espera, a prioridade baixa passa a frente
+	p.waiting[0].enqueued = now.Add(-11 * time.Minute)
+	if got := p.waiting[p.next(now)].step; got != "old-low" {
+		t.Fatalf("next = %s; esperado old-low", got)
+	}
+
+	// No empate, vale quem chegou primeiro
+	p.waiting[0].enqueued = now.Add(-10 * time.Minute)
+	if got := p.waiting[p.next(now)].step; got != "old-low" {
+		t.Fatalf("next no empate = %s; esperado old-low", got)
+	}
+}
+
+func TestWorkerPoolNextWithoutAging(t *testing.T) {
+	p := newWorkerPool(1, 0)
+	now := time.Now()
+	p.waiting = []*poolTicket{
+		{step: "old-low", priority: 0, enqueued: now.Add(-time.Hour)},
+		{step: "new-high", priority: 1, enqueued: now},
+	}
+
+	if got := p.waiting[p.next(now)].step; got != "new-high" {
+		t.Fatalf("next = %s; esperado new-high", got)
+	}
+}
+
+func TestWorkerPoolDispatchHeadOfLine(t *testing.T) {
+	p := newWorkerPool(2, 0)
+	holder := &poolTicket{step: "holder", slots: 1}
+	p.grant(holder)
+
+	big := &poolTicket{step: "big", priority: 5, slots: 2, enqueued: time.Now(), ready: make(chan struct{})}
+	small := &poolTicket{step: "small", priority: 0, slots: 1, enqueued: time.Now(), ready: make(chan struct{})}
+	p.waiting = []*poolTicket{big, small}
+
+	// small caberia na vaga livre, mas não passa na frente de big
+	p.dispatch()
+	if big.granted || small.granted {
+		t.Fatalf("dispatch entregou vaga com o próximo da fila sem caber")
+	}
+
+	p.release(holder)
+	if !big.granted || small.granted {
+		t.Fatalf("após release: big=%v small=%v; esperado só big", big.granted, small.granted)
+	}
+	if p.running != 2 || len(p.waiting) != 1 {
+		t.Fatalf("running=%d waiting=%d; esperado 2 e 1", p.running, len(p.waiting))
+	}
+
+	p.release(big)
+	if !small.granted || p.running != 1 || len(p.waiting) != 0 {
+		t.Fatalf("após liberar big: small=%v running=%d waiting=%d", small.granted, p.running, len(p.waiting))
+	}
+}
+
+func TestWorkerPoolAcquireRelease(t *testing.T) {
+	p := newWorkerPool(1, 0)
+	ctx := context.Background()
+
+	first := &poolTicket{step: "first", slots: 1}
+	if err := p.acquire(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	// acquire dos demais em goroutines, esperando cada um entrar na fila
+	// para que a ordem de chegada seja conhecida
+	granted := make(chan string, 2)
+	enqueue := func(ticket *poolTicket) {
+		queued := make(chan struct{})
+		ticket.queued = func() { close(queued) }
+		go func() {
+			if err := p.acquire(ctx, ticket); err != nil {
+				t.Error(err)
+				return
+			}
+			granted <- ticket.step
+		}()
+		<-queued
+	}
+
+	low := &poolTicket{step: "low", priority: 0, slots: 1}
+	high := &poolTicket{step: "high", priority: 5, slots: 1}
+	enqueue(low)
+	enqueue(high)
+
+	p.release(first)
+	if got := <-granted; got != "high" {
+		t.Fatalf("primeira vaga para %s; esperado high", got)
+	}
+
+	p.release(high)
+	if got := <-granted; got != "low" {
+		t.Fatalf("segunda vaga para %s; esperado low", got)
+	}
+
+	p.release(low)
+	if stats := p.stats(); stats.Running != 0 || stats.Waiting != 0 || stats.Served != 3 {
+		t.Fatalf("stats = %+v; esperado fila vazia e 3 atendidos", stats)
+	}
+}
+
+func TestWorkerPoolAcquireCancelled(t *testing.T) {
+	p := newWorkerPool(1, 0)
+	holder := &poolTicket{step: "holder", slots: 1}
+	if err := p.acquire(context.Background(), holder); err != nil {
+		t.Fatal(err)
+	}
+
+	cause := errors.New("cancelado")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	waiter := &poolTicket{step: "waiter", slots: 1}
+	waiter.queued = func() { cancel(cause) }
+
+	if err := p.acquire(ctx, waiter); !errors.Is(err, cause) {
+		t.Fatalf("acquire = %v; esperado %v", err, cause)
+	}
+	if len(p.waiting) != 0 || waiter.granted {
+		t.Fatalf("ticket cancelado continua na fila")
+	}
+
+	// A vaga segue com holder e volta livre após o release
+	p.release(holder)
+	if p.running != 0 {
+		t.Fatalf("running = %d; esperado 0", p.running)
+	}
+}
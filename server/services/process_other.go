@@ -0,0 +1,31 @@
+//go:build !unix
+
+package services
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// setProcessGroup não tem equivalente fora de sistemas unix
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// setCredential não tem equivalente fora de sistemas unix
+func setCredential(cmd *exec.Cmd, uid int, gid int) error {
+	return fmt.Errorf("usuário de execução não é suportado neste sistema")
+}
+
+// terminateProcessGroup não tem término gracioso fora de sistemas unix,
+// então o processo é encerrado imediatamente
+func terminateProcessGroup(cmd *exec.Cmd) string {
+	return killProcessGroup(cmd)
+}
+
+func killProcessGroup(cmd *exec.Cmd) string {
+	cmd.Process.Kill()
+	return "KILL"
+}
+
+func exitSignal(err error) string {
+	return ""
+}
@@ -0,0 +1,62 @@
+//go:build unix
+
+package services
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setProcessGroup faz o processo iniciar em um grupo próprio, para que os
+// subprocessos criados pelo script também recebam os sinais do executor
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// setCredential faz o processo rodar com o usuário e o grupo informados, sem
+// os grupos suplementares do servidor
+func setCredential(cmd *exec.Cmd, uid int, gid int) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	return nil
+}
+
+// terminateProcessGroup envia SIGTERM a todo o grupo do processo
+func terminateProcessGroup(cmd *exec.Cmd) string {
+	return signalProcessGroup(cmd, unix.SIGTERM)
+}
+
+// killProcessGroup envia SIGKILL a todo o grupo do processo
+func killProcessGroup(cmd *exec.Cmd) string {
+	return signalProcessGroup(cmd, unix.SIGKILL)
+}
+
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) string {
+	// pid negativo envia o sinal para o grupo inteiro
+	if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil {
+		cmd.Process.Signal(sig)
+	}
+	return unix.SignalName(sig)
+}
+
+// exitSignal retorna o sinal que encerrou o processo, se houver
+func exitSignal(err error) string {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ""
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	return unix.SignalName(status.Signal())
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"orchestrium.sh/models"
+)
+
+const (
+	BackoffFixed       = "fixed"
+	BackoffExponential = "exponential"
+)
+
+// maxRetryDelay limita a espera quando o backoff exponencial não tem
+// max_delay, já que o intervalo dobra a cada tentativa
+const maxRetryDelay = 24 * time.Hour
+
+// maxAttempts retorna quantas vezes o step pode rodar no total
+func maxAttempts(step *models.Step) int {
+	if step.Attempts < 1 {
+		return 1
+	}
+	return step.Attempts
+}
+
+// shouldRetry decide se a falha de uma tentativa deve ser repetida
+func shouldRetry(policy *models.RetryPolicy, exitCode int, timedOut bool) bool {
+	if policy == nil || (len(policy.OnExitCodes) == 0 && !policy.OnTimeout) {
+		return true
+	}
+	if timedOut {
+		return policy.OnTimeout
+	}
+	return slices.Contains(policy.OnExitCodes, exitCode)
+}
+
+// retryDelay calcula a espera antes da próxima tentativa. attempt é o número
+// da tentativa que acabou de falhar, começando em 1
+func retryDelay(policy *models.RetryPolicy, attempt int) time.Duration {
+	if policy == nil || policy.Delay <= 0 {
+		return 0
+	}
+
+	delay := float64(policy.Delay)
+	if policy.Backoff == BackoffExponential {
+		delay *= math.Pow(2, float64(attempt-1))
+	}
+
+	if policy.MaxDelay > 0 && delay > float64(policy.MaxDelay) {
+		delay = float64(policy.MaxDelay)
+	}
+	delay = min(delay, maxRetryDelay.Seconds())
+
+	// Jitter espalha as tentativas em ±jitter do intervalo calculado
+	if policy.Jitter > 0 {
+		delay += delay * policy.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay * float64(time.Second))
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"orchestrium.sh/models"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   *models.RetryPolicy
+		attempt  int
+		expected time.Duration
+	}{
+		{"sem política", nil, 3, 0},
+		{"sem delay", &models.RetryPolicy{Backoff: BackoffExponential}, 3, 0},
+		{"fixo", &models.RetryPolicy{Delay: 5}, 4, 5 * time.Second},
+		{"exponencial na primeira", &models.RetryPolicy{Delay: 2, Backoff: BackoffExponential}, 1, 2 * time.Second},
+		{"exponencial na quarta", &models.RetryPolicy{Delay: 2, Backoff: BackoffExponential}, 4, 16 * time.Second},
+		{"exponencial com max_delay", &models.RetryPolicy{Delay: 2, Backoff: BackoffExponential, MaxDelay: 10}, 4, 10 * time.Second},
+		{"fixo acima de max_delay", &models.RetryPolicy{Delay: 30, MaxDelay: 10}, 1, 10 * time.Second},
+		{"exponencial sem max_delay", &models.RetryPolicy{Delay: 1, Backoff: BackoffExponential}, 100, maxRetryDelay},
+		{"exponencial muito longo", &models.RetryPolicy{Delay: 60, Backoff: BackoffExponential}, 2000, maxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryDelay(tt.policy, tt.attempt); got != tt.expected {
+				t.Fatalf("retryDelay(tentativa %d) = %s; esperado %s", tt.attempt, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *models.RetryPolicy
+		base   time.Duration
+	}{
+		{"fixo", &models.RetryPolicy{Delay: 10, Jitter: 0.5}, 10 * time.Second},
+		{"no teto", &models.RetryPolicy{Delay: 1, Backoff: BackoffExponential, Jitter: 1}, maxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spread := time.Duration(float64(tt.base) * tt.policy.Jitter)
+			for range 200 {
+				got := retryDelay(tt.policy, 200)
+				if got < tt.base-spread || got > tt.base+spread {
+					t.Fatalf("retryDelay = %s; esperado entre %s e %s", got, tt.base-spread, tt.base+spread)
+				}
+			}
+		})
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   *models.RetryPolicy
+		exitCode int
+		timedOut bool
+		expected bool
+	}{
+		{"sem política", nil, 1, false, true},
+		{"sem filtros", &models.RetryPolicy{Delay: 5}, 2, true, true},
+		{"código listado", &models.RetryPolicy{OnExitCodes: []int{75, 111}}, 75, false, true},
+		{"código fora da lista", &models.RetryPolicy{OnExitCodes: []int{75}}, 1, false, false},
+		{"timeout sem on_timeout", &models.RetryPolicy{OnExitCodes: []int{75}}, -1, true, false},
+		{"timeout com on_timeout", &models.RetryPolicy{OnTimeout: true}, -1, true, true},
+		{"falha comum só com on_timeout", &models.RetryPolicy{OnTimeout: true}, 1, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldRetry(tt.policy, tt.exitCode, tt.timedOut); got != tt.expected {
+				t.Fatalf("shouldRetry = %v; esperado %v", got, tt.expected)
+			}
+		})
+	}
+}
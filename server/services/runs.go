@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"orchestrium.sh/models"
+)
+
+const (
+	defaultRunsLimit = 20
+	maxRunsLimit     = 100
+)
+
+// saveRun grava o registro da execução em runs/<run-id>/run.json. A escrita
+// passa por um arquivo temporário para que leitores nunca vejam JSON pela metade
+func saveRun(run *models.Run) error {
+	dir := runDir(run.WorkflowId, run.Id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, "run.json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(dir, "run.json"))
+}
+
+// loadRun lê o registro de uma execução
+func loadRun(workflowID string, runID string) (*models.Run, error) {
+	data, err := os.ReadFile(filepath.Join(runDir(workflowID, runID), "run.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var run models.Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// loadRuns lê todas as execuções de um workflow, da mais recente para a mais antiga
+func loadRuns(workflowID string) []models.Run {
+	entries, err := os.ReadDir(filepath.Join("workflows", workflowID, "runs"))
+	if err != nil {
+		return []models.Run{}
+	}
+
+	runs := make([]models.Run, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		run, err := loadRun(workflowID, entry.Name())
+		if err != nil {
+			continue
+		}
+		runs = append(runs, *run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreatedAt.After(runs[j].CreatedAt)
+	})
+
+	return runs
+}
+
+// ListRuns retorna uma página do histórico de execuções, opcionalmente
+// filtrado por status
+func (ws *WorkflowService) ListRuns(id string, status string, page int, limit int) (*models.RunListResponse, error) {
+	if _, err := os.Stat(filepath.Join("workflows", id, "conf.yaml")); err != nil {
+		return nil, fmt.Errorf("workflow não encontrado")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultRunsLimit
+	}
+	if limit > maxRunsLimit {
+		limit = maxRunsLimit
+	}
+
+	filtered := make([]models.Run, 0)
+	for _, run := range loadRuns(id) {
+		if status == "" || run.Status == status {
+			filtered = append(filtered, run)
+		}
+	}
+
+	start := min((page-1)*limit, len(filtered))
+	end := min(start+limit, len(filtered))
+
+	return &models.RunListResponse{
+		Runs:  filtered[start:end],
+		Total: len(filtered),
+		Page:  page,
+		Limit: limit,
+	}, nil
+}
+
+// GetRun retorna uma execução com o estado de cada step
+func (ws *WorkflowService) GetRun(id string, runID string) (*models.Run, error) {
+	if _, err := os.Stat(filepath.Join("workflows", id, "conf.yaml")); err != nil {
+		return nil, fmt.Errorf("workflow não encontrado")
+	}
+
+	if !isValidRunID(runID) {
+		return nil, fmt.Errorf("execução não encontrada")
+	}
+
+	run, err := loadRun(id, runID)
+	if err != nil {
+		return nil, fmt.Errorf("execução não encontrada")
+	}
+
+	return run, nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"orchestrium.sh/config"
+	"orchestrium.sh/models"
+)
+
+// RuntimeExec executa o arquivo diretamente, sem interpretador
+const RuntimeExec = "exec"
+
+// resolveCommand monta o comando que executa o step. Comandos inline rodam
+// no shell configurado; para scripts a ordem é: runtime declarado no step,
+// shebang, extensão do arquivo, bit de execução e, por fim, o runtime padrão
+// do servidor
+func resolveCommand(cfg *config.Config, step *models.Step, scriptPath string) ([]string, error) {
+	if step.Run != "" {
+		return append(slices.Clone(cfg.Shell), step.Run), nil
+	}
+
+	if step.Runtime != "" {
+		if step.Runtime == RuntimeExec {
+			return []string{scriptPath}, nil
+		}
+
+		interpreter, exists := cfg.Interpreters[step.Runtime]
+		if !exists {
+			return nil, fmt.Errorf("runtime desconhecido: %s", step.Runtime)
+		}
+		return append(slices.Clone(interpreter.Command), scriptPath), nil
+	}
+
+	if shebang := readShebang(scriptPath); len(shebang) > 0 {
+		return append(shebang, scriptPath), nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(scriptPath))
+	if ext != "" {
+		for _, interpreter := range cfg.Interpreters {
+			if slices.Contains(interpreter.Extensions, ext) {
+				return append(slices.Clone(interpreter.Command), scriptPath), nil
+			}
+		}
+	}
+
+	if info, err := os.Stat(scriptPath); err == nil && info.Mode()&0111 != 0 {
+		return []string{scriptPath}, nil
+	}
+
+	return append(slices.Clone(cfg.Interpreters[cfg.DefaultRuntime].Command), scriptPath), nil
+}
+
+// readShebang retorna o interpretador declarado na primeira linha do
+// arquivo (#!/usr/bin/env python3), ou nil se não houver
+func readShebang(scriptPath string) []string {
+	file, err := os.Open(scriptPath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && line == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(line, "#!") {
+		return nil
+	}
+
+	return strings.Fields(strings.TrimPrefix(line, "#!"))
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+
+	"orchestrium.sh/models"
+)
+
+// SandboxCommand é o primeiro argumento com que o servidor reexecuta o
+// próprio binário para preparar o isolamento antes de iniciar o step
+const SandboxCommand = "__sandbox"
+
+// sandboxSpec é o que o processo auxiliar do isolamento recebe do executor
+type sandboxSpec struct {
+	Uid      int      `json:"uid"`
+	Gid      int      `json:"gid"`
+	Writable []string `json:"writable"`
+	Network  bool     `json:"network"`
+	Command  []string `json:"command"`
+	// Rlimits são aplicados logo antes do exec do comando, já que o próprio
+	// processo auxiliar não roda sob limites de memória baixos
+	Rlimits []rlimit `json:"rlimits,omitempty"`
+}
+
+// sandboxIdentity resolve o usuário e o grupo de execução, por nome ou id.
+// Sem group vale o grupo primário do usuário; sem user, o usuário do
+// servidor. Retorna -1 quando nenhum dos dois foi definido
+func sandboxIdentity(sandbox *models.Sandbox) (int, int, error) {
+	if sandbox == nil || (sandbox.User == "" && sandbox.Group == "") {
+		return -1, -1, nil
+	}
+
+	uid, gid := os.Getuid(), os.Getgid()
+
+	if sandbox.User != "" {
+		u, err := user.Lookup(sandbox.User)
+		if err != nil {
+			u, err = user.LookupId(sandbox.User)
+		}
+		if err != nil {
+			return -1, -1, fmt.Errorf("usuário desconhecido: %s", sandbox.User)
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+
+	if sandbox.Group != "" {
+		g, err := user.LookupGroup(sandbox.Group)
+		if err != nil {
+			g, err = user.LookupGroupId(sandbox.Group)
+		}
+		if err != nil {
+			return -1, -1, fmt.Errorf("grupo desconhecido: %s", sandbox.Group)
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	return uid, gid, nil
+}
+
+// validateSandbox confere a configuração de sandbox do workflow
+func validateSandbox(sandbox *models.Sandbox, add func(field string, format string, args ...any)) {
+	if sandbox == nil {
+		return
+	}
+
+	if _, _, err := sandboxIdentity(sandbox); err != nil {
+		field := "sandbox.user"
+		if sandbox.User == "" {
+			field = "sandbox.group"
+		}
+		add(field, "%v", err)
+	}
+
+	if sandbox.Network && !sandbox.Isolate {
+		add("sandbox.network", "só se aplica com isolate")
+	}
+}
+
+// sandboxCommand monta o comando conforme o sandbox do workflow: com usuário
+// de execução, o processo perde os privilégios do servidor; com isolate,
+// passa antes pelo processo auxiliar que monta o isolamento. writable são os
+// caminhos em que o processo precisa gravar; os demais ficam somente leitura
+func (we *WorkflowExecutor) sandboxCommand(command []string, writable []string) (*exec.Cmd, error) {
+	if we.sandbox == nil {
+		return exec.Command(command[0], command[1:]...), nil
+	}
+
+	uid, gid, err := sandboxIdentity(we.sandbox)
+	if err != nil {
+		return nil, err
+	}
+
+	// O processo precisa conseguir gravar nos caminhos informados, como o
+	// arquivo de outputs do step
+	if uid >= 0 {
+		for _, path := range writable {
+			if err := os.Chown(path, uid, gid); err != nil {
+				return nil, fmt.Errorf("erro ao preparar %s: %w", filepath.Base(path), err)
+			}
+		}
+	}
+
+	if we.sandbox.Isolate {
+		return isolatedCommand(sandboxSpec{
+			Uid:      uid,
+			Gid:      gid,
+			Writable: writable,
+			Network:  we.sandbox.Network,
+			Command:  command,
+		})
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	if uid >= 0 {
+		if err := setCredential(cmd, uid, gid); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+// chownWorkspace passa o workspace para o usuário de execução do sandbox
+func (we *WorkflowExecutor) chownWorkspace(dir string) error {
+	uid, gid, err := sandboxIdentity(we.sandbox)
+	if err != nil || uid < 0 {
+		return err
+	}
+
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
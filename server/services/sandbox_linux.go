@@ -0,0 +1,239 @@
+//go:build linux
+
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// remountFlags são as opções de montagem preservadas ao tornar um ponto de
+// montagem somente leitura; o kernel recusa o remount se alguma for removida
+const remountFlags = unix.ST_NOSUID | unix.ST_NODEV | unix.ST_NOEXEC | unix.ST_NOATIME | unix.ST_NODIRATIME | unix.ST_RELATIME
+
+// isolatedCommand reexecuta o servidor em novos namespaces de montagem, IPC
+// e, sem network, de rede. O processo auxiliar (RunSandbox) prepara as
+// montagens e então executa o comando do step no lugar dele
+func isolatedCommand(spec sandboxSpec) (*exec.Cmd, error) {
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("isolamento requer o servidor rodando como root")
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao localizar o executável do servidor: %w", err)
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := uintptr(unix.CLONE_NEWNS | unix.CLONE_NEWIPC)
+	if !spec.Network {
+		flags |= unix.CLONE_NEWNET
+	}
+
+	cmd := exec.Command(self, SandboxCommand, string(data))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: flags}
+	return cmd, nil
+}
+
+// RunSandbox é o processo auxiliar do isolamento: deixa a raiz somente
+// leitura, exceto os caminhos graváveis do step, monta um /tmp próprio,
+// troca de usuário e executa o comando. Não retorna em caso de sucesso
+func RunSandbox(args []string) {
+	if err := runSandbox(args); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		os.Exit(126)
+	}
+}
+
+func runSandbox(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("uso: %s <spec>", SandboxCommand)
+	}
+
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(args[0]), &spec); err != nil {
+		return fmt.Errorf("spec inválida: %w", err)
+	}
+	if len(spec.Command) == 0 {
+		return fmt.Errorf("comando vazio")
+	}
+
+	// Nada montado aqui pode vazar para o namespace do servidor
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("erro ao isolar montagens: %w", err)
+	}
+
+	// Os caminhos graváveis viram montagens próprias, que o remount
+	// somente leitura abaixo não alcança
+	for _, path := range spec.Writable {
+		if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("erro ao montar %s: %w", path, err)
+		}
+	}
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+
+	for _, mount := range mounts {
+		if isWritablePath(mount, spec.Writable) {
+			continue
+		}
+
+		var stat unix.Statfs_t
+		if err := unix.Statfs(mount, &stat); err != nil {
+			continue
+		}
+		if stat.Flags&unix.ST_RDONLY != 0 {
+			continue
+		}
+
+		flags := uintptr(unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY) | uintptr(stat.Flags&remountFlags)
+		if err := unix.Mount("", mount, "", flags, ""); err != nil {
+			return fmt.Errorf("erro ao tornar %s somente leitura: %w", mount, err)
+		}
+	}
+
+	// Caminhos graváveis dentro de /tmp ficariam escondidos pelo tmpfs; eles
+	// são montados de novo por cima dele a partir de um descritor aberto antes
+	hidden := make(map[string]*os.File)
+	for _, path := range spec.Writable {
+		if !isWritablePath(path, []string{"/tmp"}) {
+			continue
+		}
+		file, err := os.OpenFile(path, unix.O_PATH, 0)
+		if err != nil {
+			return fmt.Errorf("erro ao abrir %s: %w", path, err)
+		}
+		defer file.Close()
+		hidden[path] = file
+	}
+
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("erro ao montar /tmp: %w", err)
+	}
+
+	for path, file := range hidden {
+		if err := rebind(file, path); err != nil {
+			return fmt.Errorf("erro ao montar %s: %w", path, err)
+		}
+	}
+
+	// O diretório atual ainda aponta para a montagem de antes do bind;
+	// entrar de novo faz o step usar a montagem gravável
+	if wd, err := os.Getwd(); err == nil {
+		if err := os.Chdir(wd); err != nil {
+			return err
+		}
+	}
+
+	if spec.Gid >= 0 {
+		if err := syscall.Setgroups(nil); err != nil {
+			return fmt.Errorf("erro ao trocar grupos: %w", err)
+		}
+		if err := syscall.Setgid(spec.Gid); err != nil {
+			return fmt.Errorf("erro ao trocar grupo: %w", err)
+		}
+	}
+	if spec.Uid >= 0 {
+		if err := syscall.Setuid(spec.Uid); err != nil {
+			return fmt.Errorf("erro ao trocar usuário: %w", err)
+		}
+	}
+
+	path, err := exec.LookPath(spec.Command[0])
+	if err != nil {
+		return err
+	}
+
+	if err := setRlimits(spec.Rlimits); err != nil {
+		return err
+	}
+
+	return syscall.Exec(path, spec.Command, os.Environ())
+}
+
+// rebind recria o caminho no tmpfs e monta nele o diretório ou arquivo original
+func rebind(file *os.File, path string) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			return err
+		}
+	}
+
+	return unix.Mount(fmt.Sprintf("/proc/self/fd/%d", file.Fd()), path, "", unix.MS_BIND, "")
+}
+
+// mountPoints lista os pontos de montagem visíveis no namespace atual
+func mountPoints() ([]string, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler montagens: %w", err)
+	}
+	defer file.Close()
+
+	mounts := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mounts = append(mounts, unescapeMountPath(fields[4]))
+	}
+
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath desfaz o escape octal (\040 etc.) usado em mountinfo
+func unescapeMountPath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			var c byte
+			if _, err := fmt.Sscanf(path[i+1:i+4], "%03o", &c); err == nil {
+				b.WriteByte(c)
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// isWritablePath indica se o ponto de montagem é um dos caminhos graváveis
+// ou está dentro de um deles
+func isWritablePath(mount string, writable []string) bool {
+	for _, path := range writable {
+		if mount == path || strings.HasPrefix(mount, path+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// isolatedCommand depende de namespaces, que só existem no Linux
+func isolatedCommand(spec sandboxSpec) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("isolamento só é suportado no Linux")
+}
+
+func RunSandbox(args []string) {
+	fmt.Fprintln(os.Stderr, "sandbox: isolamento só é suportado no Linux")
+	os.Exit(126)
+}
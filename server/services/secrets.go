@@ -0,0 +1,298 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"orchestrium.sh/models"
+)
+
+const (
+	SecretScopeGlobal   = "global"
+	SecretScopeWorkflow = "workflow"
+)
+
+// secretMask substitui os valores dos secrets nos logs
+const secretMask = "***"
+
+// minMaskLength evita mascarar valores muito curtos, que apagariam dígitos e
+// palavras comuns do log inteiro
+const minMaskLength = 4
+
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// storedSecret é como cada secret fica em disco. Value guarda o nonce seguido
+// do texto cifrado com AES-GCM, em base64
+type storedSecret struct {
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// secretsPath retorna o arquivo de secrets globais (id vazio) ou de um workflow
+func secretsPath(id string) string {
+	if id == "" {
+		return "secrets.json"
+	}
+	return filepath.Join("workflows", id, "secrets.json")
+}
+
+// secretScope retorna o escopo correspondente ao id
+func secretScope(id string) string {
+	if id == "" {
+		return SecretScopeGlobal
+	}
+	return SecretScopeWorkflow
+}
+
+// secretCipher deriva a chave AES-256 da chave mestra do servidor
+func (ws *WorkflowService) secretCipher() (cipher.AEAD, error) {
+	if ws.config.MasterKey == "" {
+		return nil, fmt.Errorf("chave mestra não configurada")
+	}
+
+	key := sha256.Sum256([]byte(ws.config.MasterKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// readSecrets carrega os secrets cifrados de um escopo. Sem arquivo, o escopo
+// simplesmente não tem secrets
+func readSecrets(id string) (map[string]storedSecret, error) {
+	secrets := make(map[string]storedSecret)
+
+	data, err := os.ReadFile(secretsPath(id))
+	if os.IsNotExist(err) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("erro ao ler secrets: %w", err)
+	}
+
+	return secrets, nil
+}
+
+// writeSecrets grava os secrets de um escopo de forma atômica, legíveis apenas
+// pelo usuário do servidor
+func writeSecrets(id string, secrets map[string]storedSecret) error {
+	path := secretsPath(id)
+
+	data, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// checkSecretScope confere se o workflow existe quando o escopo não é global
+func checkSecretScope(id string) error {
+	if id == "" {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join("workflows", id, "conf.yaml")); err != nil {
+		return fmt.Errorf("workflow não encontrado")
+	}
+	return nil
+}
+
+// ListSecrets lista os secrets de um escopo sem os valores
+func (ws *WorkflowService) ListSecrets(id string) ([]models.SecretInfo, error) {
+	if err := checkSecretScope(id); err != nil {
+		return nil, err
+	}
+
+	ws.secretsMu.Lock()
+	secrets, err := readSecrets(id)
+	ws.secretsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.SecretInfo, 0, len(secrets))
+	for name, secret := range secrets {
+		list = append(list, models.SecretInfo{
+			Name:      name,
+			Scope:     secretScope(id),
+			CreatedAt: secret.CreatedAt,
+			UpdatedAt: secret.UpdatedAt,
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
+
+// SetSecret cria ou substitui um secret. O valor é cifrado antes de ir para o disco
+func (ws *WorkflowService) SetSecret(id string, name string, value string) error {
+	if err := checkSecretScope(id); err != nil {
+		return err
+	}
+
+	if !secretNamePattern.MatchString(name) {
+		return fmt.Errorf("nome inválido: use letras, números e _, sem começar por número")
+	}
+	if strings.HasPrefix(strings.ToUpper(name), "ORCHESTRIUM_") {
+		return fmt.Errorf("nome inválido: o prefixo ORCHESTRIUM_ é reservado")
+	}
+	if value == "" {
+		return fmt.Errorf("valor do secret é obrigatório")
+	}
+
+	aead, err := ws.secretCipher()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), secretAAD(id, name))
+
+	ws.secretsMu.Lock()
+	defer ws.secretsMu.Unlock()
+
+	secrets, err := readSecrets(id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	secret, exists := secrets[name]
+	if !exists {
+		secret.CreatedAt = now
+	}
+	secret.Value = base64.StdEncoding.EncodeToString(sealed)
+	secret.UpdatedAt = now
+	secrets[name] = secret
+
+	return writeSecrets(id, secrets)
+}
+
+// DeleteSecret remove um secret do escopo
+func (ws *WorkflowService) DeleteSecret(id string, name string) error {
+	if err := checkSecretScope(id); err != nil {
+		return err
+	}
+
+	ws.secretsMu.Lock()
+	defer ws.secretsMu.Unlock()
+
+	secrets, err := readSecrets(id)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := secrets[name]; !exists {
+		return fmt.Errorf("secret não encontrado")
+	}
+	delete(secrets, name)
+
+	return writeSecrets(id, secrets)
+}
+
+// resolveSecrets decifra os secrets globais e os do workflow. Em caso de
+// nome repetido, vale o do workflow
+func (ws *WorkflowService) resolveSecrets(id string) (map[string]string, error) {
+	ws.secretsMu.Lock()
+	defer ws.secretsMu.Unlock()
+
+	values := make(map[string]string)
+
+	for _, scope := range []string{"", id} {
+		secrets, err := readSecrets(scope)
+		if err != nil {
+			return nil, err
+		}
+		if len(secrets) == 0 {
+			continue
+		}
+
+		aead, err := ws.secretCipher()
+		if err != nil {
+			return nil, err
+		}
+
+		for name, secret := range secrets {
+			sealed, err := base64.StdEncoding.DecodeString(secret.Value)
+			if err != nil || len(sealed) < aead.NonceSize() {
+				return nil, fmt.Errorf("secret %s corrompido", name)
+			}
+
+			nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+			plain, err := aead.Open(nil, nonce, ciphertext, secretAAD(scope, name))
+			if err != nil {
+				return nil, fmt.Errorf("não foi possível decifrar o secret %s", name)
+			}
+			values[name] = string(plain)
+		}
+	}
+
+	return values, nil
+}
+
+// secretAAD amarra o texto cifrado ao escopo e ao nome, impedindo que um
+// valor seja copiado para outro secret no arquivo
+func secretAAD(id string, name string) []byte {
+	return []byte(secretScope(id) + "/" + id + "/" + name)
+}
+
+// newSecretMasker monta o replacer que esconde os valores dos secrets nos
+// logs. Valores com várias linhas são mascarados linha a linha, já que o log
+// é gravado por linha
+func newSecretMasker(secrets map[string]string) *strings.Replacer {
+	values := make([]string, 0, len(secrets))
+	for _, value := range secrets {
+		for _, line := range strings.Split(value, "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if len(line) >= minMaskLength {
+				values = append(values, line)
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	// Valores maiores primeiro, para que um secret contido em outro não
+	// deixe pedaços do maior à mostra
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+
+	pairs := make([]string, 0, len(values)*2)
+	for _, value := range values {
+		pairs = append(pairs, value, secretMask)
+	}
+
+	return strings.NewReplacer(pairs...)
+}
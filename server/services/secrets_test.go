@@ -0,0 +1,170 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"orchestrium.sh/config"
+)
+
+// testSecretService cria o serviço em um diretório temporário com um
+// workflow "wf" para os secrets de escopo workflow
+func testSecretService(t *testing.T, masterKey string) *WorkflowService {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	if err := os.MkdirAll(filepath.Join("workflows", "wf"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("workflows", "wf", "conf.yaml"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return &WorkflowService{config: &config.Config{MasterKey: masterKey}}
+}
+
+func TestSecretsEncryptDecrypt(t *testing.T) {
+	ws := testSecretService(t, "master-key")
+
+	if err := ws.SetSecret("", "TOKEN", "global-value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SetSecret("", "SHARED", "global-shared"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SetSecret("wf", "SHARED", "workflow-shared"); err != nil {
+		t.Fatal(err)
+	}
+
+	// O valor não fica em texto puro no disco
+	data, err := os.ReadFile(secretsPath(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "global-value") {
+		t.Fatalf("secret gravado em texto puro")
+	}
+
+	values, err := ws.resolveSecrets("wf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["TOKEN"] != "global-value" || values["SHARED"] != "workflow-shared" {
+		t.Fatalf("resolveSecrets = %v; esperado TOKEN global e SHARED do workflow", values)
+	}
+
+	// Com outra chave mestra, nada é decifrado
+	other := &WorkflowService{config: &config.Config{MasterKey: "other-key"}}
+	if _, err := other.resolveSecrets("wf"); err == nil {
+		t.Fatalf("secrets decifrados com a chave mestra errada")
+	}
+}
+
+func TestSecretsBoundToScopeAndName(t *testing.T) {
+	tests := []struct {
+		name string
+		move func(t *testing.T)
+	}{
+		{
+			name: "valor copiado para outro nome",
+			move: func(t *testing.T) {
+				secrets, _ := readSecrets("")
+				secrets["OTHER"] = secrets["TOKEN"]
+				delete(secrets, "TOKEN")
+				if err := writeSecrets("", secrets); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "valor global copiado para o workflow",
+			move: func(t *testing.T) {
+				secrets, _ := readSecrets("")
+				if err := writeSecrets("", nil); err != nil {
+					t.Fatal(err)
+				}
+				if err := writeSecrets("wf", secrets); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := testSecretService(t, "master-key")
+			if err := ws.SetSecret("", "TOKEN", "global-value"); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.move(t)
+
+			if values, err := ws.resolveSecrets("wf"); err == nil {
+				t.Fatalf("secret movido decifrado: %v", values)
+			}
+		})
+	}
+}
+
+func TestSecretsWithoutMasterKey(t *testing.T) {
+	ws := testSecretService(t, "")
+
+	if err := ws.SetSecret("", "TOKEN", "value"); err == nil {
+		t.Fatalf("secret gravado sem chave mestra")
+	}
+
+	// Sem secrets gravados, a execução não depende da chave
+	if values, err := ws.resolveSecrets("wf"); err != nil || len(values) != 0 {
+		t.Fatalf("resolveSecrets = %v, %v; esperado vazio", values, err)
+	}
+}
+
+func TestSecretMasker(t *testing.T) {
+	mask := newSecretMasker(map[string]string{
+		"SHORT":     "abc",
+		"TOKEN":     "s3cr3t",
+		"LONGER":    "s3cr3t-and-more",
+		"MULTILINE": "first-line\r\nsecond-line",
+	})
+
+	tests := map[string]string{
+		"token=s3cr3t":                    "token=***",
+		"long=s3cr3t-and-more":            "long=***",
+		"abc fica visível":                "abc fica visível",
+		"key: first-line":                 "key: ***",
+		"second-line e mais nada":         "*** e mais nada",
+		"s3cr3t e s3cr3t-and-more juntos": "*** e *** juntos",
+	}
+	for input, expected := range tests {
+		if got := mask.Replace(input); got != expected {
+			t.Errorf("Replace(%q) = %q; esperado %q", input, got, expected)
+		}
+	}
+
+	if newSecretMasker(map[string]string{"SHORT": "abc"}) != nil {
+		t.Errorf("máscara criada só com valores curtos")
+	}
+}
+
+func TestOutputsMasked(t *testing.T) {
+	dir := t.TempDir()
+	sr := testStepRun()
+	sr.log.mask = newSecretMasker(map[string]string{"TOKEN": "s3cr3t"})
+	sr.outputFile = filepath.Join(dir, "outputs")
+	sr.stdout.onLine = sr.collectOutput
+	if err := sr.resetOutputs(); err != nil {
+		t.Fatal(err)
+	}
+
+	sr.stdout.Write([]byte("::output marker=token s3cr3t\n"))
+	if err := os.WriteFile(sr.outputFile, []byte("file=Bearer s3cr3t\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sr.readOutputFile()
+
+	if sr.outputs["marker"] != "token ***" || sr.outputs["file"] != "Bearer ***" {
+		t.Fatalf("outputs = %v; esperado valores mascarados", sr.outputs)
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Regras de disparo no estilo Airflow, avaliadas quando todas as
+// dependências do step terminaram
+const (
+	TriggerAllSuccess = "all_success"
+	TriggerAllFailed  = "all_failed"
+	TriggerAllDone    = "all_done"
+	TriggerOneSuccess = "one_success"
+	TriggerOneFailed  = "one_failed"
+	TriggerNoneFailed = "none_failed"
+	TriggerAlways     = "always"
+)
+
+var triggerRules = []string{
+	TriggerAllSuccess, TriggerAllFailed, TriggerAllDone, TriggerOneSuccess,
+	TriggerOneFailed, TriggerNoneFailed, TriggerAlways,
+}
+
+// evaluateTriggerRule decide se o step roda a partir do status final das
+// dependências. Quando não roda, retorna o status do step: "upstream_failed"
+// se a regra falhou por causa de uma dependência com falha e "skipped" nos
+// demais casos
+func evaluateTriggerRule(rule string, upstream map[string]string) (bool, string, string) {
+	if rule == "" {
+		rule = TriggerAllSuccess
+	}
+
+	var succeeded, failed, skipped []string
+	for dep, status := range upstream {
+		switch status {
+		case "success":
+			succeeded = append(succeeded, dep)
+		case "skipped":
+			skipped = append(skipped, dep)
+		default:
+			// failed, upstream_failed, cancelled ou dependência inexistente
+			failed = append(failed, dep)
+		}
+	}
+
+	failedReason := fmt.Sprintf("Dependência falhou: %s", strings.Join(failed, ", "))
+	skippedReason := fmt.Sprintf("Regra %s não atendida", rule)
+
+	switch rule {
+	case TriggerAllFailed:
+		if len(succeeded) == 0 && len(skipped) == 0 {
+			return true, "", ""
+		}
+		return false, "skipped", skippedReason
+
+	case TriggerAllDone, TriggerAlways:
+		return true, "", ""
+
+	case TriggerOneSuccess:
+		if len(succeeded) > 0 || len(upstream) == 0 {
+			return true, "", ""
+		}
+		if len(failed) > 0 {
+			return false, "upstream_failed", failedReason
+		}
+		return false, "skipped", skippedReason
+
+	case TriggerOneFailed:
+		if len(failed) > 0 {
+			return true, "", ""
+		}
+		return false, "skipped", skippedReason
+
+	case TriggerNoneFailed:
+		if len(failed) == 0 {
+			return true, "", ""
+		}
+		return false, "upstream_failed", failedReason
+
+	default:
+		if len(failed) > 0 {
+			return false, "upstream_failed", failedReason
+		}
+		if len(skipped) > 0 {
+			return false, "skipped", skippedReason
+		}
+		return true, "", ""
+	}
+}
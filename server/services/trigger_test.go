@@ -0,0 +1,47 @@
+package services
+
+import "testing"
+
+func TestEvaluateTriggerRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		upstream map[string]string
+		run      bool
+		status   string
+	}{
+		{"padrão com todas ok", "", map[string]string{"a": "success", "b": "success"}, true, ""},
+		{"padrão com falha", "", map[string]string{"a": "success", "b": "failed"}, false, "upstream_failed"},
+		{"padrão com skipped", "", map[string]string{"a": "success", "b": "skipped"}, false, "skipped"},
+		{"padrão sem dependências", "", map[string]string{}, true, ""},
+		{"all_success com cancelada", TriggerAllSuccess, map[string]string{"a": "cancelled"}, false, "upstream_failed"},
+
+		{"all_failed com todas falhas", TriggerAllFailed, map[string]string{"a": "failed", "b": "upstream_failed"}, true, ""},
+		{"all_failed com uma ok", TriggerAllFailed, map[string]string{"a": "failed", "b": "success"}, false, "skipped"},
+
+		{"all_done com falha", TriggerAllDone, map[string]string{"a": "failed", "b": "skipped"}, true, ""},
+		{"always com falha", TriggerAlways, map[string]string{"a": "failed"}, true, ""},
+
+		{"one_success com uma ok", TriggerOneSuccess, map[string]string{"a": "failed", "b": "success"}, true, ""},
+		{"one_success sem ok e com falha", TriggerOneSuccess, map[string]string{"a": "failed", "b": "skipped"}, false, "upstream_failed"},
+		{"one_success só com skipped", TriggerOneSuccess, map[string]string{"a": "skipped"}, false, "skipped"},
+
+		{"one_failed com falha", TriggerOneFailed, map[string]string{"a": "success", "b": "failed"}, true, ""},
+		{"one_failed sem falha", TriggerOneFailed, map[string]string{"a": "success"}, false, "skipped"},
+
+		{"none_failed com skipped", TriggerNoneFailed, map[string]string{"a": "success", "b": "skipped"}, true, ""},
+		{"none_failed com falha", TriggerNoneFailed, map[string]string{"a": "success", "b": "failed"}, false, "upstream_failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run, status, reason := evaluateTriggerRule(tt.rule, tt.upstream)
+			if run != tt.run || status != tt.status {
+				t.Fatalf("evaluateTriggerRule(%q, %v) = %v, %q; esperado %v, %q", tt.rule, tt.upstream, run, status, tt.run, tt.status)
+			}
+			if !run && reason == "" {
+				t.Errorf("step não executado sem motivo")
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/robfig/cron/v3"
+
+	"orchestrium.sh/models"
+)
+
+// cronParser usa os mesmos campos do scheduler criado com cron.WithSeconds
+var cronParser = cron.NewParser(
+	cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// InvalidWorkflowError agrupa os erros de validação de um conf.yaml
+type InvalidWorkflowError struct {
+	Errors []models.ValidationError
+}
+
+func (e *InvalidWorkflowError) Error() string {
+	return "configuração inválida"
+}
+
+// ValidateWorkflow valida a configuração informada ou, se workflow for nil,
+// o conf.yaml salvo do workflow
+func (ws *WorkflowService) ValidateWorkflow(id string, workflow *models.WorkflowResponse) ([]models.ValidationError, error) {
+	if workflow == nil {
+		path := filepath.Join("workflows", id, "conf.yaml")
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("workflow não encontrado")
+		}
+
+		workflow = &models.WorkflowResponse{}
+		if err := yaml.Unmarshal(data, workflow); err != nil {
+			return []models.ValidationError{{Field: "conf.yaml", Message: err.Error()}}, nil
+		}
+	} else if _, err := os.Stat(filepath.Join("workflows", id, "conf.yaml")); err != nil {
+		return nil, fmt.Errorf("workflow não encontrado")
+	}
+
+	return ws.validateConfig(id, workflow), nil
+}
+
+// validateConfig verifica a estrutura do workflow antes de agendar ou salvar.
+// Quando id não é vazio, também confere se os scripts existem em src/
+func (ws *WorkflowService) validateConfig(id string, workflow *models.WorkflowResponse) []models.ValidationError {
+	errs := make([]models.ValidationError, 0)
+	add := func(field string, format string, args ...any) {
+		errs = append(errs, models.ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(workflow.Expr) == "" {
+		add("expr", "expressão cron é obrigatória")
+	} else if _, err := cronParser.Parse(workflow.Expr); err != nil {
+		add("expr", "expressão cron inválida: %v", err)
+	}
+
+	if workflow.Parallelism < 0 {
+		add("parallelism", "não pode ser negativo")
+	}
+
+	switch workflow.Concurrency {
+	case "", ConcurrencyAllow, ConcurrencySkip, ConcurrencyQueue, ConcurrencyReplace:
+	default:
+		add("concurrency", "deve ser %q, %q, %q ou %q", ConcurrencyAllow, ConcurrencySkip, ConcurrencyQueue, ConcurrencyReplace)
+	}
+
+	if workflow.MaxActiveRuns < 0 {
+		add("max_active_runs", "não pode ser negativo")
+	}
+
+	if workflow.Timeout < 0 {
+		add("timeout", "não pode ser negativo")
+	}
+
+	if workflow.Deadline != "" {
+		if _, err := parseDeadline(workflow.Deadline); err != nil {
+			add("deadline", "horário inválido: %v", err)
+		}
+	}
+
+	switch workflow.WorkspaceCleanup {
+	case "", WorkspaceCleanupAlways, WorkspaceCleanupOnSuccess, WorkspaceCleanupNever:
+	default:
+		add("workspace_cleanup", "deve ser %q, %q ou %q", WorkspaceCleanupAlways, WorkspaceCleanupOnSuccess, WorkspaceCleanupNever)
+	}
+
+	validateLimits("limits", workflow.Limits, add)
+	validateSandbox(workflow.Sandbox, add)
+	validateParamDecls(workflow.Params, add)
+
+	index := make(map[string]int)
+	for i, step := range workflow.Steps {
+		field := fmt.Sprintf("steps[%d]", i)
+
+		if strings.TrimSpace(step.Name) == "" {
+			add(field+".name", "nome do step é obrigatório")
+		} else if first, exists := index[step.Name]; exists {
+			add(field+".name", "nome duplicado (já usado em steps[%d])", first)
+		} else {
+			index[step.Name] = i
+		}
+
+		if step.Timeout < 0 {
+			add(field+".timeout", "não pode ser negativo")
+		}
+		if step.GracePeriod < 0 {
+			add(field+".grace_period", "não pode ser negativo")
+		}
+		if step.Attempts < 0 {
+			add(field+".attempts", "não pode ser negativo")
+		}
+
+		if step.Retry != nil {
+			if step.Retry.Delay < 0 {
+				add(field+".retry.delay", "não pode ser negativo")
+			}
+			if step.Retry.MaxDelay < 0 {
+				add(field+".retry.max_delay", "não pode ser negativo")
+			}
+			if step.Retry.Backoff != "" && step.Retry.Backoff != BackoffFixed && step.Retry.Backoff != BackoffExponential {
+				add(field+".retry.backoff", "deve ser %q ou %q", BackoffFixed, BackoffExponential)
+			}
+			if step.Retry.Jitter < 0 || step.Retry.Jitter > 1 {
+				add(field+".retry.jitter", "deve estar entre 0 e 1")
+			}
+		}
+
+		validateLimits(field+".limits", step.Limits, add)
+
+		for j, pattern := range step.Artifacts {
+			if err := validateArtifactPattern(pattern); err != nil {
+				add(fmt.Sprintf("%s.artifacts[%d]", field, j), "%v", err)
+			}
+		}
+
+		if step.PoolSlots < 0 {
+			add(field+".pool_slots", "não pode ser negativo")
+		}
+		if step.Pool != "" {
+			if size, exists := ws.config.Pools[step.Pool]; !exists {
+				add(field+".pool", "pool não configurado no servidor: %s", step.Pool)
+			} else if poolSlots(&step) > size {
+				add(field+".pool_slots", "excede as %d vagas do pool %s", size, step.Pool)
+			}
+		} else if step.PoolSlots != 0 {
+			add(field+".pool_slots", "exige pool")
+		}
+
+		for j, label := range step.RunsOn {
+			if strings.TrimSpace(label) == "" {
+				add(fmt.Sprintf("%s.runs_on[%d]", field, j), "não pode ser vazio")
+			}
+		}
+		if len(step.RunsOn) > 0 {
+			if ws.config.AgentToken == "" {
+				add(field+".runs_on", "exige token de agente configurado no servidor")
+			}
+			// O workspace do agente é descartado ao fim do step
+			if len(step.Artifacts) > 0 {
+				add(field+".artifacts", "não é suportado em steps com runs_on")
+			}
+			if workflow.Sandbox != nil {
+				add(field+".runs_on", "não é compatível com sandbox")
+			}
+		}
+
+		if step.TriggerRule != "" && !slices.Contains(triggerRules, step.TriggerRule) {
+			add(field+".trigger_rule", "deve ser um de: %s", strings.Join(triggerRules, ", "))
+		}
+
+		if step.Runtime != "" && step.Runtime != RuntimeExec {
+			if _, exists := ws.config.Interpreters[step.Runtime]; !exists {
+				add(field+".runtime", "runtime desconhecido: %s", step.Runtime)
+			}
+		}
+
+		hasScript := strings.TrimSpace(step.Script) != ""
+		hasRun := strings.TrimSpace(step.Run) != ""
+		if hasScript == hasRun {
+			add(field, "defina exatamente um entre script e run")
+		}
+		if hasRun && step.Runtime != "" {
+			add(field+".runtime", "não se aplica a steps com run")
+		}
+
+		if hasScript && id != "" {
+			scriptPath := filepath.Join("workflows", id, "src", step.Script)
+			if !ws.isPathSafe(id, scriptPath) {
+				add(field+".script", "caminho fora de src/")
+			} else if info, err := os.Stat(scriptPath); err != nil || info.IsDir() {
+				add(field+".script", "arquivo %s não encontrado em src/", step.Script)
+			}
+		}
+	}
+
+	for i, step := range workflow.Steps {
+		for j, dep := range step.Depends {
+			field := fmt.Sprintf("steps[%d].depends[%d]", i, j)
+			if dep == step.Name {
+				add(field, "step não pode depender de si mesmo")
+			} else if _, exists := index[dep]; !exists {
+				add(field, "dependência desconhecida: %s", dep)
+			}
+		}
+	}
+
+	for _, cycle := range findCycles(workflow.Steps, index) {
+		add(fmt.Sprintf("steps[%d].depends", index[cycle[0]]), "dependência circular: %s", strings.Join(cycle, " -> "))
+	}
+
+	return errs
+}
+
+// findCycles percorre o grafo de dependências em profundidade e retorna
+// cada ciclo encontrado, fechando no step em que começou
+func findCycles(steps []models.Step, index map[string]int) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	color := make(map[string]int)
+	path := make([]string, 0)
+	cycles := make([][]string, 0)
+
+	var visit func(name string)
+	visit = func(name string) {
+		color[name] = visiting
+		path = append(path, name)
+
+		for _, dep := range steps[index[name]].Depends {
+			if _, exists := index[dep]; !exists || dep == name {
+				continue
+			}
+			switch color[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				for k := len(path) - 1; k >= 0; k-- {
+					if path[k] == dep {
+						cycle := append([]string{}, path[k:]...)
+						cycles = append(cycles, append(cycle, dep))
+						break
+					}
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		color[name] = visited
+	}
+
+	for i, step := range steps {
+		if first, exists := index[step.Name]; exists && first == i && color[step.Name] == unvisited {
+			visit(step.Name)
+		}
+	}
+
+	return cycles
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"orchestrium.sh/models"
+)
+
+func TestFindCycles(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []models.Step
+		cycles [][]string
+	}{
+		{
+			name: "sem ciclo",
+			steps: []models.Step{
+				{Name: "a"},
+				{Name: "b", Depends: []string{"a"}},
+				{Name: "c", Depends: []string{"a", "b"}},
+			},
+			cycles: [][]string{},
+		},
+		{
+			name: "ciclo entre dois steps",
+			steps: []models.Step{
+				{Name: "a", Depends: []string{"b"}},
+				{Name: "b", Depends: []string{"a"}},
+			},
+			cycles: [][]string{{"a", "b", "a"}},
+		},
+		{
+			name: "ciclo longo a partir de um step fora dele",
+			steps: []models.Step{
+				{Name: "start", Depends: []string{"x"}},
+				{Name: "x", Depends: []string{"y"}},
+				{Name: "y", Depends: []string{"z"}},
+				{Name: "z", Depends: []string{"x"}},
+			},
+			cycles: [][]string{{"x", "y", "z", "x"}},
+		},
+		{
+			name: "dependência de si mesmo e inexistente são ignoradas",
+			steps: []models.Step{
+				{Name: "a", Depends: []string{"a", "missing"}},
+				{Name: "b", Depends: []string{"a"}},
+			},
+			cycles: [][]string{},
+		},
+		{
+			name: "dois ciclos independentes",
+			steps: []models.Step{
+				{Name: "a", Depends: []string{"b"}},
+				{Name: "b", Depends: []string{"a"}},
+				{Name: "c", Depends: []string{"d"}},
+				{Name: "d", Depends: []string{"c"}},
+			},
+			cycles: [][]string{{"a", "b", "a"}, {"c", "d", "c"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := make(map[string]int)
+			for i, step := range tt.steps {
+				index[step.Name] = i
+			}
+
+			cycles := findCycles(tt.steps, index)
+			if !reflect.DeepEqual(cycles, tt.cycles) {
+				t.Fatalf("findCycles = %v; esperado %v", cycles, tt.cycles)
+			}
+		})
+	}
+}
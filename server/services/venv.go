@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"orchestrium.sh/models"
+)
+
+// Arquivos de dependências reconhecidos em src/, na ordem de preferência
+var requirementsFiles = []string{"requirements.txt", "pyproject.toml"}
+
+// pythonCommand reconhece comandos que chamam o python, com ou sem versão
+var pythonCommand = regexp.MustCompile(`^python[0-9.]*$`)
+
+// venvBuildTimeout limita a criação do ambiente, incluindo o pip install
+const venvBuildTimeout = 30 * time.Minute
+
+// venvLocks serializa a criação de um mesmo ambiente por execuções simultâneas
+var venvLocks sync.Map
+
+// venvRoot retorna o diretório dos ambientes em cache de um workflow
+func venvRoot(workflowID string) string {
+	return filepath.Join("workflows", workflowID, "venvs")
+}
+
+// environmentLogPath retorna onde fica o log de criação do ambiente da execução
+func environmentLogPath(workflowID string, runID string) string {
+	return filepath.Join(runDir(workflowID, runID), "environment", "build.log")
+}
+
+// detectRequirements procura o arquivo de dependências e calcula o hash que
+// identifica o ambiente. Retorna source vazio quando não há dependências
+func detectRequirements(dir string) (string, string, error) {
+	for _, name := range requirementsFiles {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+
+		sum := sha256.Sum256(append([]byte(name+"\n"), data...))
+		return name, hex.EncodeToString(sum[:])[:16], nil
+	}
+	return "", "", nil
+}
+
+// readEnvironment lê o estado salvo de um ambiente
+func readEnvironment(workflowID string, hash string) (*models.Environment, error) {
+	data, err := os.ReadFile(filepath.Join(venvRoot(workflowID), hash+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var env models.Environment
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// writeEnvironment grava o estado de um ambiente ao lado dele
+func writeEnvironment(workflowID string, env *models.Environment) error {
+	if err := os.MkdirAll(venvRoot(workflowID), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(venvRoot(workflowID), env.Hash+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// prepareEnvironment garante o virtualenv do workflow quando o workspace tem
+// requirements.txt ou pyproject.toml. Ambientes prontos são reaproveitados
+// enquanto o arquivo de dependências não muda; falhas são refeitas na próxima execução
+func (we *WorkflowExecutor) prepareEnvironment(ctx context.Context) error {
+	source, hash, err := detectRequirements(we.workspace)
+	if err != nil {
+		return fmt.Errorf("erro ao ler dependências: %w", err)
+	}
+	if source == "" {
+		return nil
+	}
+
+	dir, err := filepath.Abs(filepath.Join(venvRoot(we.workflowID), hash))
+	if err != nil {
+		return err
+	}
+
+	lock, _ := venvLocks.LoadOrStore(dir, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	log, err := openStepLog(environmentLogPath(we.workflowID, we.runID))
+	if err != nil {
+		return fmt.Errorf("erro ao criar log do ambiente: %w", err)
+	}
+	defer log.Close()
+	log.mask = we.secretMask
+
+	if env, err := readEnvironment(we.workflowID, hash); err == nil && env.Status == "ready" {
+		if _, err := os.Stat(filepath.Join(dir, "bin", "python")); err == nil {
+			log.System("usando ambiente em cache %s (%s)", hash, source)
+			env.Cached = true
+			we.setEnvironment(env, dir)
+			return nil
+		}
+	}
+
+	env := &models.Environment{
+		Hash:      hash,
+		Source:    source,
+		Status:    "building",
+		StartTime: time.Now(),
+	}
+	we.setEnvironment(env, "")
+	writeEnvironment(we.workflowID, env)
+	fmt.Printf("[WORKFLOW %s] Criando ambiente python %s a partir de %s\n", we.workflowID, hash, source)
+
+	buildErr := we.buildEnvironment(ctx, log, source, dir)
+
+	env.EndTime = time.Now()
+	if buildErr != nil {
+		env.Status = "failed"
+		env.Error = buildErr.Error()
+		os.RemoveAll(dir)
+	} else {
+		env.Status = "ready"
+	}
+	writeEnvironment(we.workflowID, env)
+
+	if buildErr != nil {
+		we.setEnvironment(env, "")
+		log.System("falha ao criar ambiente: %v", buildErr)
+		return fmt.Errorf("erro ao criar ambiente python: %w", buildErr)
+	}
+
+	log.System("ambiente %s pronto", hash)
+	we.setEnvironment(env, dir)
+	return nil
+}
+
+// buildEnvironment cria o virtualenv já no caminho definitivo, porque o venv
+// grava caminhos absolutos nos scripts de bin/. Só o estado "ready" gravado
+// ao final marca o ambiente como utilizável. O pip install roda código do
+// próprio workflow (setup.py, backend do pyproject), então os comandos passam
+// pelo mesmo sandbox e pelos mesmos limites de recursos dos steps; com
+// isolate sem network, dependências externas não podem ser baixadas
+func (we *WorkflowExecutor) buildEnvironment(ctx context.Context, log *stepLog, source string, dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	python := "python3"
+	if interpreter, exists := we.config.Interpreters["python"]; exists {
+		python = interpreter.Command[0]
+	}
+
+	install := []string{filepath.Join(dir, "bin", "python"), "-m", "pip", "install", "--disable-pip-version-check", "--no-cache-dir"}
+	if source == "requirements.txt" {
+		install = append(install, "-r", "requirements.txt")
+	} else {
+		install = append(install, ".")
+	}
+
+	// O build é tratado como um step sem limites próprios: valem os do workflow
+	build := &models.Step{Name: "environment", Timeout: int(venvBuildTimeout / time.Second)}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, venvBuildTimeout, fmt.Errorf("criação do ambiente expirada (timeout)"))
+	defer cancel()
+
+	for i, command := range [][]string{{python, "-m", "venv", dir}, install} {
+		log.System("$ %s", strings.Join(command, " "))
+
+		cmd, err := we.sandboxCommand(command, []string{we.workspace, dir})
+		if err != nil {
+			return err
+		}
+		cmd.Dir = we.workspace
+		cmd.Env = serverEnv()
+
+		stdout, stderr := log.Stream(StreamStdout), log.Stream(StreamStderr)
+		name := fmt.Sprintf("%s-environment-%d", we.runID, i+1)
+		state := models.AttemptState{Number: i + 1, StartTime: time.Now()}
+		if _, err := runProcess(ctx, we.config, build, we.stepLimits(build), name, cmd, stdout, stderr, state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setEnvironment registra o ambiente da execução e o diretório do venv
+// usado pelos steps
+func (we *WorkflowExecutor) setEnvironment(env *models.Environment, dir string) {
+	we.mu.Lock()
+	snapshot := *env
+	we.environment = &snapshot
+	we.venv = dir
+	we.mu.Unlock()
+
+	we.persist()
+}
+
+// venvCommand troca o python do comando pelo do virtualenv, inclusive em
+// shebangs com /usr/bin/env
+func (we *WorkflowExecutor) venvCommand(command []string) []string {
+	if we.venv == "" {
+		return command
+	}
+
+	python := filepath.Join(we.venv, "bin", "python")
+	if pythonCommand.MatchString(filepath.Base(command[0])) {
+		return append([]string{python}, command[1:]...)
+	}
+	if filepath.Base(command[0]) == "env" && len(command) > 1 && pythonCommand.MatchString(command[1]) {
+		return append([]string{python}, command[2:]...)
+	}
+	return command
+}
+
+// GetEnvironment retorna o estado do ambiente correspondente ao src/ atual
+// do workflow. Sem arquivo de dependências, retorna nil
+func (ws *WorkflowService) GetEnvironment(id string) (*models.Environment, error) {
+	if _, err := os.Stat(filepath.Join("workflows", id, "conf.yaml")); err != nil {
+		return nil, fmt.Errorf("workflow não encontrado")
+	}
+
+	source, hash, err := detectRequirements(filepath.Join("workflows", id, "src"))
+	if err != nil {
+		return nil, err
+	}
+	if source == "" {
+		return nil, nil
+	}
+
+	env, err := readEnvironment(id, hash)
+	if err != nil {
+		return &models.Environment{Hash: hash, Source: source, Status: "missing"}, nil
+	}
+	return env, nil
+}
+
+// GetEnvironmentLog retorna o log de criação do ambiente de uma execução
+func (ws *WorkflowService) GetEnvironmentLog(id string, runID string) ([]models.LogEntry, error) {
+	if _, err := os.Stat(filepath.Join("workflows", id, "conf.yaml")); err != nil {
+		return nil, fmt.Errorf("workflow não encontrado")
+	}
+
+	if !isValidRunID(runID) {
+		return nil, fmt.Errorf("execução não encontrada")
+	}
+
+	entries, err := readStepLog(environmentLogPath(id, runID), "")
+	if err != nil {
+		return nil, fmt.Errorf("log não encontrado")
+	}
+
+	return entries, nil
+}
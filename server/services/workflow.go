@@ -1,29 +1,44 @@
 package services
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/goccy/go-yaml"
 	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
 
+	"orchestrium.sh/config"
 	"orchestrium.sh/models"
 )
 
 type WorkflowService struct {
+	config    *config.Config
 	scheduler *cron.Cron
 	registry  map[string]cron.EntryID
+	active    map[string]*activeRun
+	queues    map[string][]*activeRun
 	mu        sync.RWMutex
+	secretsMu sync.Mutex
+	pool      *workerPool
+	pools     map[string]*workerPool
+	agents    *agentHub
 }
 
-func NewWorkflowService(scheduler *cron.Cron) *WorkflowService {
+func NewWorkflowService(scheduler *cron.Cron, cfg *config.Config) *WorkflowService {
 	return &WorkflowService{
+		config:    cfg,
 		scheduler: scheduler,
 		registry:  make(map[string]cron.EntryID),
+		active:    make(map[string]*activeRun),
+		queues:    make(map[string][]*activeRun),
+		pool:      newWorkerPool(cfg.MaxRunningSteps, time.Duration(cfg.PriorityAging)*time.Second),
+		pools:     newPools(cfg.Pools, time.Duration(cfg.PriorityAging)*time.Second),
+		agents:    newAgentHub(time.Duration(cfg.AgentLease) * time.Second),
 	}
 }
 
@@ -36,43 +51,153 @@ func (ws *WorkflowService) Execute(id string, expr string) error {
 	}
 
 	entryID, err := ws.scheduler.AddFunc(expr, func() {
-		// Ler o arquivo conf.yaml a cada execução
-		path := filepath.Join("workflows", id, "conf.yaml")
-		data, err := os.ReadFile(path)
+		executor, err := ws.prepareRun(id, models.TriggerSchedule, nil)
 		if err != nil {
-			fmt.Printf("[WORKFLOW %s] Erro ao ler conf.yaml: %v\n", id, err)
+			var invalid *InvalidWorkflowError
+			if errors.As(err, &invalid) {
+				for _, e := range invalid.Errors {
+					fmt.Printf("[WORKFLOW %s] Configuração inválida em %s: %s\n", id, e.Field, e.Message)
+				}
+				return
+			}
+			fmt.Printf("[WORKFLOW %s] %v\n", id, err)
 			return
 		}
 
-		var workflow models.WorkflowResponse
-		if err := yaml.Unmarshal(data, &workflow); err != nil {
-			fmt.Printf("[WORKFLOW %s] Erro ao fazer parse do YAML: %v\n", id, err)
-			return
+		ws.launch(executor)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	ws.registry[id] = entryID
+	return nil
+}
+
+// RunNow inicia uma execução imediata, mesmo com o workflow pausado, e
+// retorna o id da execução sem esperar que ela termine. A política de
+// concorrência do workflow vale também aqui, então a execução pode ficar
+// na fila ou ser descartada; o status retornado indica qual foi o caso
+func (ws *WorkflowService) RunNow(id string, req *models.RunRequest) (string, string, error) {
+	executor, err := ws.prepareRun(id, models.TriggerManual, req)
+	if err != nil {
+		return "", "", err
+	}
+
+	return executor.RunID(), ws.launch(executor), nil
+}
+
+// prepareRun lê o conf.yaml a cada execução, aplica a seleção de steps do
+// pedido (se houver) e valida o resultado antes de montar o executor
+func (ws *WorkflowService) prepareRun(id string, trigger string, req *models.RunRequest) (*WorkflowExecutor, error) {
+	path := filepath.Join("workflows", id, "conf.yaml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("workflow não encontrado")
+	}
+
+	var workflow models.WorkflowResponse
+	if err := yaml.Unmarshal(data, &workflow); err != nil {
+		return nil, fmt.Errorf("erro ao ler configuração")
+	}
+
+	if req != nil && len(req.Steps) > 0 {
+		steps, err := selectSteps(workflow.Steps, req.Steps, req.Upstream)
+		if err != nil {
+			return nil, err
 		}
+		workflow.Steps = steps
+	}
+
+	// Validar se há steps
+	if len(workflow.Steps) == 0 {
+		return nil, fmt.Errorf("nenhum step configurado")
+	}
+
+	// Validar a estrutura antes de executar
+	if errs := ws.validateConfig(id, &workflow); len(errs) > 0 {
+		return nil, &InvalidWorkflowError{Errors: errs}
+	}
+
+	// Execuções agendadas não informam params e usam os defaults
+	var supplied map[string]any
+	if req != nil {
+		supplied = req.Params
+	}
+
+	params, errs := resolveParams(workflow.Params, supplied)
+	if len(errs) > 0 {
+		return nil, &InvalidWorkflowError{Errors: errs}
+	}
+
+	secrets, err := ws.resolveSecrets(id)
+	if err != nil {
+		return nil, err
+	}
+
+	executor := NewWorkflowExecutor(id, &workflow, trigger, params, ws.config)
+	executor.setSecrets(secrets)
+	executor.pool = ws.pool
+	executor.pools = ws.pools
+	executor.agents = ws.agents
+
+	if req != nil && req.Priority != nil {
+		executor.priority = *req.Priority
+		executor.priorityOverride = req.Priority
+	}
+
+	return executor, nil
+}
 
-		// Validar se há steps
-		if len(workflow.Steps) == 0 {
-			fmt.Printf("[WORKFLOW %s] Nenhum step configurado\n", id)
+// selectSteps mantém apenas os steps pedidos e, com upstream, as dependências
+// deles. Dependências fora da seleção são consideradas satisfeitas
+func selectSteps(steps []models.Step, names []string, upstream bool) ([]models.Step, error) {
+	index := make(map[string]int)
+	for i, step := range steps {
+		index[step.Name] = i
+	}
+
+	selected := make(map[string]bool)
+	var include func(name string)
+	include = func(name string) {
+		if selected[name] {
 			return
 		}
+		selected[name] = true
+		if upstream {
+			for _, dep := range steps[index[name]].Depends {
+				if _, exists := index[dep]; exists {
+					include(dep)
+				}
+			}
+		}
+	}
 
-		// Criar executor
-		srcPath := filepath.Join("workflows", id, "src")
-		executor := NewWorkflowExecutor(id, workflow.Steps)
+	for _, name := range names {
+		if _, exists := index[name]; !exists {
+			return nil, fmt.Errorf("step desconhecido: %s", name)
+		}
+		include(name)
+	}
 
-		// Executar com contexto (sem timeout global, deixar para os steps)
-		ctx := context.Background()
-		if err := executor.Execute(ctx, srcPath); err != nil {
-			fmt.Printf("[WORKFLOW %s] Erro na execução: %v\n", id, err)
+	result := make([]models.Step, 0, len(selected))
+	for _, step := range steps {
+		if !selected[step.Name] {
+			continue
 		}
-	})
 
-	if err != nil {
-		return err
+		depends := make([]string, 0, len(step.Depends))
+		for _, dep := range step.Depends {
+			if selected[dep] {
+				depends = append(depends, dep)
+			}
+		}
+		step.Depends = depends
+		result = append(result, step)
 	}
 
-	ws.registry[id] = entryID
-	return nil
+	return result, nil
 }
 
 func (ws *WorkflowService) GetAllWorkflows() ([]models.WorkflowResponse, error) {
@@ -130,6 +255,17 @@ func (ws *WorkflowService) GetWorkflow(id string) (*models.WorkflowResponse, err
 }
 
 func (ws *WorkflowService) CreateWorkflow(req models.WorkflowRequest) (string, error) {
+	conf := models.WorkflowResponse{
+		Name:  req.Name,
+		Expr:  req.Expr,
+		Stts:  true,
+		Steps: []models.Step{},
+	}
+
+	if errs := ws.validateConfig("", &conf); len(errs) > 0 {
+		return "", &InvalidWorkflowError{Errors: errs}
+	}
+
 	id := uuid.New().String()
 	path := filepath.Join("workflows", id)
 	src := filepath.Join(path, "src")
@@ -138,13 +274,6 @@ func (ws *WorkflowService) CreateWorkflow(req models.WorkflowRequest) (string, e
 		return "", fmt.Errorf("erro ao criar diretórios")
 	}
 
-	conf := models.WorkflowResponse{
-		Name:  req.Name,
-		Expr:  req.Expr,
-		Stts:  true,
-		Steps: []models.Step{},
-	}
-
 	data, _ := yaml.Marshal(&conf)
 
 	if err := os.WriteFile(filepath.Join(path, "conf.yaml"), data, 0644); err != nil {
@@ -158,7 +287,9 @@ func (ws *WorkflowService) CreateWorkflow(req models.WorkflowRequest) (string, e
 	return id, nil
 }
 
-func (ws *WorkflowService) PauseWorkflow(id string) error {
+// PauseWorkflow remove o workflow do scheduler. Com cancelActive, também
+// cancela as execuções que estiverem em andamento
+func (ws *WorkflowService) PauseWorkflow(id string, cancelActive bool) error {
 	path := filepath.Join("workflows", id, "conf.yaml")
 
 	data, err := os.ReadFile(path)
@@ -179,6 +310,12 @@ func (ws *WorkflowService) PauseWorkflow(id string) error {
 	}
 	ws.mu.Unlock()
 
+	if cancelActive {
+		if n := ws.cancelActiveRuns(id); n > 0 {
+			fmt.Printf("[JOB %s] %d execução(ões) em andamento cancelada(s)\n", id, n)
+		}
+	}
+
 	workflow.Stts = false
 	newData, _ := yaml.Marshal(&workflow)
 
@@ -206,6 +343,12 @@ func (ws *WorkflowService) ResumeWorkflow(id string) error {
 		return fmt.Errorf("o workflow já está ativo")
 	}
 
+	errs := ws.validateConfig(id, &workflow)
+	errs = append(errs, validateScheduledParams(workflow.Params)...)
+	if len(errs) > 0 {
+		return &InvalidWorkflowError{Errors: errs}
+	}
+
 	if err := ws.Execute(id, workflow.Expr); err != nil {
 		return fmt.Errorf("erro ao agendar tarefa")
 	}
@@ -301,10 +444,21 @@ func (ws *WorkflowService) BootstrapWorkflows() error {
 			var w models.WorkflowResponse
 			yaml.Unmarshal(data, &w)
 
-			if w.Stts {
-				ws.Execute(id, w.Expr)
-				fmt.Printf("[Bootstrap] Workflow %s iniciado\n", id)
+			if !w.Stts {
+				continue
 			}
+
+			errs := ws.validateConfig(id, &w)
+			errs = append(errs, validateScheduledParams(w.Params)...)
+			if len(errs) > 0 {
+				for _, e := range errs {
+					fmt.Printf("[Bootstrap] Workflow %s inválido em %s: %s\n", id, e.Field, e.Message)
+				}
+				continue
+			}
+
+			ws.Execute(id, w.Expr)
+			fmt.Printf("[Bootstrap] Workflow %s iniciado\n", id)
 		}
 	}
 
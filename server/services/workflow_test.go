@@ -0,0 +1,86 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"orchestrium.sh/models"
+)
+
+func TestSelectSteps(t *testing.T) {
+	// extract -> transform -> load
+	//         -> report
+	steps := []models.Step{
+		{Name: "extract"},
+		{Name: "transform", Depends: []string{"extract"}},
+		{Name: "report", Depends: []string{"extract"}},
+		{Name: "load", Depends: []string{"transform"}},
+	}
+
+	tests := []struct {
+		name     string
+		names    []string
+		upstream bool
+		expected map[string][]string
+	}{
+		{
+			name:     "só o step pedido",
+			names:    []string{"load"},
+			expected: map[string][]string{"load": {}},
+		},
+		{
+			name:     "com upstream",
+			names:    []string{"load"},
+			upstream: true,
+			expected: map[string][]string{"extract": {}, "transform": {"extract"}, "load": {"transform"}},
+		},
+		{
+			name:     "dois steps sem upstream mantém a dependência entre eles",
+			names:    []string{"load", "transform"},
+			expected: map[string][]string{"transform": {}, "load": {"transform"}},
+		},
+		{
+			name:     "upstream compartilhado aparece uma vez",
+			names:    []string{"report", "load"},
+			upstream: true,
+			expected: map[string][]string{"extract": {}, "transform": {"extract"}, "report": {"extract"}, "load": {"transform"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := selectSteps(steps, tt.names, tt.upstream)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string][]string)
+			for _, step := range selected {
+				got[step.Name] = step.Depends
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("selectSteps = %v; esperado %v", got, tt.expected)
+			}
+		})
+	}
+
+	// Os steps selecionados mantêm a ordem original e o workflow não é alterado
+	selected, _ := selectSteps(steps, []string{"load", "extract"}, false)
+	if len(selected) != 2 || selected[0].Name != "extract" || selected[1].Name != "load" {
+		t.Fatalf("ordem dos steps = %v", selected)
+	}
+	if len(steps[3].Depends) != 1 {
+		t.Fatalf("dependências do workflow alteradas: %v", steps[3].Depends)
+	}
+}
+
+func TestSelectStepsUnknown(t *testing.T) {
+	steps := []models.Step{{Name: "extract"}, {Name: "load", Depends: []string{"extract"}}}
+
+	for _, upstream := range []bool{false, true} {
+		_, err := selectSteps(steps, []string{"load", "missing"}, upstream)
+		if err == nil || err.Error() != "step desconhecido: missing" {
+			t.Fatalf("selectSteps com step desconhecido (upstream=%v): %v", upstream, err)
+		}
+	}
+}
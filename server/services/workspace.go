@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	WorkspaceCleanupAlways    = "always"
+	WorkspaceCleanupOnSuccess = "on_success"
+	WorkspaceCleanupNever     = "never"
+)
+
+// workspaceDir retorna o diretório de trabalho de uma execução
+func workspaceDir(workflowID string, runID string) string {
+	return filepath.Join(runDir(workflowID, runID), "workspace")
+}
+
+// prepareWorkspace cria o diretório de trabalho da execução com uma cópia de
+// src/, para que arquivos gerados por uma execução não cheguem à próxima
+func (we *WorkflowExecutor) prepareWorkspace(srcPath string) error {
+	dir, err := filepath.Abs(workspaceDir(we.workflowID, we.runID))
+	if err != nil {
+		return err
+	}
+
+	if err := copyTree(srcPath, dir); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("erro ao preparar workspace: %w", err)
+	}
+
+	if err := we.chownWorkspace(dir); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("erro ao preparar workspace: %w", err)
+	}
+
+	we.mu.Lock()
+	we.workspace = dir
+	we.mu.Unlock()
+
+	return nil
+}
+
+// cleanupWorkspace remove o diretório de trabalho conforme a política do
+// workflow. Deve ser chamada depois de finish, com o status final definido
+func (we *WorkflowExecutor) cleanupWorkspace() {
+	we.mu.RLock()
+	dir, status := we.workspace, we.status
+	we.mu.RUnlock()
+
+	if dir == "" {
+		return
+	}
+
+	switch we.workspaceCleanup {
+	case WorkspaceCleanupNever:
+		return
+	case WorkspaceCleanupOnSuccess:
+		if status != "success" {
+			fmt.Printf("[WORKFLOW %s] Workspace mantido em %s\n", we.workflowID, dir)
+			return
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		fmt.Printf("[WORKFLOW %s] Erro ao remover workspace: %v\n", we.workflowID, err)
+	}
+}
+
+// copyTree copia src para dst preservando permissões, para que o bit de
+// execução continue valendo na escolha do runtime. Links simbólicos são
+// recriados como links
+func copyTree(src string, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+
+		// Sockets, pipes e afins não fazem sentido no workspace
+		return nil
+	})
+}
+
+func copyFile(src string, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}